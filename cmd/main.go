@@ -1,19 +1,34 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	logv2 "github.com/ViaQ/logerr/v2/log"
 	log "github.com/ViaQ/logerr/v2/log/static"
 	"github.com/log-file-metric-exporter/pkg/auth"
+	"github.com/log-file-metric-exporter/pkg/certwatch"
+	"github.com/log-file-metric-exporter/pkg/config"
+	"github.com/log-file-metric-exporter/pkg/enrich"
+	"github.com/log-file-metric-exporter/pkg/filewatch"
+	"github.com/log-file-metric-exporter/pkg/health"
 	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/log-file-metric-exporter/pkg/position"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var (
@@ -122,6 +137,88 @@ func InitLogger(verbosity int) {
 	log.SetLogger(logger)
 }
 
+// reloadFilters loads the configuration file and applies its container filters to the watchers.
+// Other configuration changes take effect when the exporter is restarted.
+func reloadFilters(path, dir string, watchers map[string]*logwatch.Watcher) {
+	log.Info("reloading configuration filters", "path", path)
+	cfg, err := config.Load(path)
+	if err != nil {
+		log.Error(err, "error reloading configuration, keeping previous filters", "path", path)
+		return
+	}
+	for _, root := range cfg.WatchRoots(dir) {
+		w := watchers[root.Dir]
+		if w == nil {
+			log.Info("new root is not watched until restart", "path", root.Dir)
+			continue
+		}
+		if err := w.SetFilter(root.Filter); err != nil {
+			log.Error(err, "error applying filter", "path", root.Dir)
+		}
+	}
+}
+
+// saveCheckpoint saves the checkpoint of all watchers.
+func saveCheckpoint(watchers map[string]*logwatch.Watcher, path string) {
+	c := &logwatch.Checkpoint{}
+	for _, w := range watchers {
+		c.Files = append(c.Files, w.Checkpoint().Files...)
+	}
+	if err := c.Save(path); err != nil {
+		log.Error(err, "error saving checkpoint", "path", path)
+	}
+}
+
+// saveCheckpoints saves the checkpoint of all watchers every interval until ctx is done.
+func saveCheckpoints(ctx context.Context, watchers map[string]*logwatch.Watcher, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			saveCheckpoint(watchers, path)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// waitTimeout waits for wg until ctx is done, returns false if ctx is done first.
+func waitTimeout(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newEnricher creates a Pod metadata enricher using in-cluster configuration,
+// and waits until its Pod cache is filled.
+func newEnricher(nodeName string, c enrich.Config) (*enrich.Enricher, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	e := enrich.New(client, nodeName, c)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := e.Start(ctx); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
 func main() {
 	var (
 		dir           string
@@ -132,9 +229,33 @@ func main() {
 		tlsMinVersion string
 		cipherSuites  string
 		secureMetrics bool
+		clientCAFile  string
+		tokenFile     string
+		htpasswdFile  string
+		clientNames   string
 		groups        string
+
+		authCacheTTL         time.Duration
+		authCacheNegativeTTL time.Duration
+
+		checkpointFile     string
+		checkpointInterval time.Duration
+
+		fluentdPosFiles   string
+		vectorCheckpoints string
+
+		configFile string
+		nodeName   string
+
+		backend       string
+		pollInterval  time.Duration
+		workers       int
+		coalesceDelay time.Duration
+
+		shutdownTimeout  time.Duration
+		progressDeadline time.Duration
 	)
-	flag.StringVar(&dir, "dir", logDir, "Directory containing log files")
+	flag.StringVar(&dir, "dir", logDir, "Directory containing log files, if there are no roots in the configuration file")
 	flag.IntVar(&verbosity, "verbosity", 0, "set verbosity level")
 	flag.StringVar(&addr, "http", ":2112", "HTTP service address where metrics are exposed")
 	flag.StringVar(&crtFile, "crtFile", "/etc/fluent/metrics/tls.crt", "cert file for log-file-metric-exporter service")
@@ -142,24 +263,77 @@ func main() {
 	flag.StringVar(&tlsMinVersion, "tlsMinVersion", "", "minimal TLS version to accept")
 	flag.StringVar(&cipherSuites, "cipherSuites", "", "cipher suites to accept")
 	flag.BoolVar(&secureMetrics, "secureMetrics", false, "require valid bearer token for metrics scraping")
+	flag.StringVar(&clientCAFile, "clientCAFile", "", "PEM bundle of CAs, enables scraping with a client certificate signed by one of them")
+	flag.StringVar(&clientNames, "clientNames", "", "comma-separated subjects, common names or SANs of the client certificates allowed with -clientCAFile, any if empty")
+	flag.StringVar(&tokenFile, "tokenFile", "", "CSV file of bearer tokens allowed to scrape metrics, as token,user[,uid,groups], instead of the Kubernetes API with -secureMetrics")
+	flag.StringVar(&htpasswdFile, "htpasswdFile", "", "htpasswd file of users allowed to scrape metrics with basic authentication, instead of the Kubernetes API with -secureMetrics")
+	flag.DurationVar(&authCacheTTL, "authCacheTTL", 2*time.Minute, "time to cache accepted tokens and allowed access with -secureMetrics, 0 to disable")
+	flag.DurationVar(&authCacheNegativeTTL, "authCacheNegativeTTL", 10*time.Second, "time to cache rejected tokens and denied access with -secureMetrics, 0 to disable")
 	flag.StringVar(&groups, "groups", "", "TLS groups/curves to use for key exchange (e.g. X25519,secp256r1,secp384r1)")
+	flag.StringVar(&checkpointFile, "checkpointFile", "", "file to save log file offsets, so counting resumes where it stopped after a restart")
+	flag.DurationVar(&checkpointInterval, "checkpointInterval", 30*time.Second, "interval between writes of the checkpoint file")
+	flag.StringVar(&fluentdPosFiles, "fluentdPosFiles", "", "glob pattern of fluentd pos_file files, enables the log_collector_unread_bytes metric")
+	flag.StringVar(&vectorCheckpoints, "vectorCheckpoints", "", "glob pattern of Vector checkpoints.json files, enables the log_collector_unread_bytes metric")
+	flag.StringVar(&configFile, "config", "", "YAML configuration file")
+	flag.StringVar(&backend, "watcher", "inotify", "file system watcher: inotify, fanotify to watch the whole log file system with a single mark, or poll for file systems without inotify support")
+	flag.DurationVar(&pollInterval, "pollInterval", 10*time.Second, "interval between polls of the log files with -watcher=poll")
+	flag.IntVar(&workers, "workers", logwatch.DefaultWorkers, "number of goroutines processing file events for each directory")
+	flag.DurationVar(&coalesceDelay, "coalesceDelay", 0, "delay before processing file events, events for the same file within the delay are processed once")
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", 10*time.Second, "maximum time to process queued events, save the checkpoint and stop the HTTP server on SIGTERM or SIGINT")
+	flag.DurationVar(&progressDeadline, "progressDeadline", 2*time.Minute, "maximum time a file event can wait to be processed before /healthz fails")
+	flag.StringVar(&nodeName, "nodeName", os.Getenv("NODE_NAME"), "node of the Pods to look up for metadata enrichment, all nodes if empty")
 	flag.Parse()
 
 	InitLogger(verbosity)
-	log.Info("start log metric exporter", "path", dir)
 
-	w, err := logwatch.New(dir)
-	if err != nil {
-		log.Error(err, "watch error", "path", dir)
-		os.Exit(1)
+	// Cancelled on SIGTERM or SIGINT, or when the exporter fails.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	cfg := &config.Config{}
+	if configFile != "" {
+		var err error
+		if cfg, err = config.Load(configFile); err != nil {
+			log.Error(err, "error loading configuration", "path", configFile)
+			os.Exit(1)
+		}
 	}
-	defer w.Close()
-	go func() {
-		if err := w.Watch(); err != nil {
-			log.Error(err, "error in watch", "path", dir)
+
+	var checkpoint *logwatch.Checkpoint
+	if checkpointFile != "" {
+		var err error
+		if checkpoint, err = logwatch.LoadCheckpoint(checkpointFile); err != nil {
+			// Not fatal, files are counted from the start as if there was no checkpoint.
+			log.Error(err, "error loading checkpoint", "path", checkpointFile)
+		}
+	}
+	var positions position.Readers
+	if fluentdPosFiles != "" {
+		positions = append(positions, position.Fluentd{Glob: fluentdPosFiles})
+	}
+	if vectorCheckpoints != "" {
+		positions = append(positions, position.Vector{Glob: vectorCheckpoints})
+	}
+
+	var watcherPollInterval time.Duration
+	switch backend {
+	case "inotify", "fanotify":
+	case "poll":
+		if pollInterval <= 0 {
+			log.Error(errors.New("invalid poll interval"), "invalid poll interval", "pollInterval", pollInterval)
 			os.Exit(1)
 		}
-	}()
+		watcherPollInterval = pollInterval
+	default:
+		log.Error(errors.New("unsupported watcher"), "unsupported watcher", "watcher", backend)
+		os.Exit(1)
+	}
+
+	exitCode := 0
+	failed := sync.OnceFunc(func() {
+		exitCode = 1
+		stop()
+	})
 
 	tlsConfig := tls.Config{}
 
@@ -194,25 +368,203 @@ func main() {
 		tlsConfig.CurvePreferences = parseTLSGroups(strings.Split(groups, ","))
 	}
 
+	// Loaded before serving, so /readyz can report whether the TLS material is usable.
+	// The certificate is reloaded when its files change, e.g. when it is rotated by the service-ca operator.
+	certs, err := certwatch.New(crtFile, keyFile)
+	if err != nil {
+		log.Error(err, "error loading TLS certificate", "crtFile", crtFile, "keyFile", keyFile)
+		os.Exit(1)
+	}
+	defer certs.Close()
+	tlsConfig.GetCertificate = certs.GetCertificate
+	if clientCAFile != "" {
+		if tlsConfig.ClientCAs, err = auth.LoadClientCAs(clientCAFile); err != nil {
+			log.Error(err, "error loading client CAs", "clientCAFile", clientCAFile)
+			os.Exit(1)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	prometheus.MustRegister(certs.ExpiryMetric(logwatch.SelfMetricPrefix))
+
+	// The HTTP server starts before the log directories are walked, so that probes can see the exporter is not ready yet.
+	started := atomic.Bool{} // All roots are walked and watched.
+	checks := &health.Checks{}
+	checks.AddReadiness("tls", func() error {
+		if certs.Certificate() == nil {
+			return errors.New("no certificate loaded")
+		}
+		return nil
+	})
+	checks.AddReadiness("watchers", func() error {
+		if !started.Load() {
+			return errors.New("initial walk in progress")
+		}
+		return nil
+	})
+
 	// Build a server:
 	httpServer := http.Server{
 		Addr:         addr,
 		TLSConfig:    &tlsConfig,
 		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)), // disable HTTP/2
 	}
-	handler := http.Handler(promhttp.Handler())
-	if secureMetrics {
-		authenticator, err := auth.NewKubeAuthenticator()
+	metricsHandler := promhttp.Handler()
+	handler := http.Handler(metricsHandler)
+	var authenticator auth.Authenticator
+	var authorizer auth.Authorizer // Any authenticated user is allowed if nil.
+	switch {
+	case tokenFile != "" && htpasswdFile != "":
+		log.Error(errors.New("conflicting options"), "only one of -tokenFile and -htpasswdFile can be set")
+		os.Exit(1)
+	case tokenFile != "":
+		tokens, err := auth.NewTokenFile(tokenFile)
+		if err != nil {
+			log.Error(err, "failed to create authenticator", "tokenFile", tokenFile)
+			os.Exit(1)
+		}
+		defer tokens.Close()
+		log.Info("metrics endpoint secured with static bearer tokens", "tokenFile", tokenFile)
+		authenticator = tokens
+	case htpasswdFile != "":
+		htpasswd, err := auth.NewHtpasswd(htpasswdFile)
+		if err != nil {
+			log.Error(err, "failed to create authenticator", "htpasswdFile", htpasswdFile)
+			os.Exit(1)
+		}
+		defer htpasswd.Close()
+		log.Info("metrics endpoint secured with basic authentication", "htpasswdFile", htpasswdFile)
+		authenticator = htpasswd
+	case secureMetrics:
+		kubeAuthenticator, err := auth.NewKubeAuthenticator()
 		if err != nil {
 			log.Error(err, "failed to create authenticator")
 			os.Exit(1)
 		}
+		if authCacheTTL > 0 || authCacheNegativeTTL > 0 {
+			cache := auth.NewReviewCache(authCacheTTL, authCacheNegativeTTL, logwatch.SelfMetricPrefix)
+			prometheus.MustRegister(cache)
+			kubeAuthenticator.SetCache(cache)
+		}
 		log.Info("metrics endpoint secured with bearer token authentication")
-		handler = auth.AuthMiddleware(authenticator, handler)
+		authenticator, authorizer = kubeAuthenticator, kubeAuthenticator
+	}
+	if authenticator != nil {
+		handler = auth.AuthMiddleware(authenticator, authorizer, metricsHandler)
+	}
+	if clientCAFile != "" {
+		// Client certificates are optional in the TLS handshake, so probes can connect without one.
+		// Scrapes without a verified certificate fall back to token or basic authentication if it is enabled.
+		var fallback http.Handler
+		if authenticator != nil {
+			fallback = handler
+		}
+		var allowedNames []string
+		for _, name := range strings.Split(clientNames, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				allowedNames = append(allowedNames, name)
+			}
+		}
+		log.Info("metrics endpoint secured with client certificate authentication", "clientCAFile", clientCAFile, "clientNames", allowedNames)
+		handler = auth.ClientCertMiddleware(allowedNames, metricsHandler, fallback)
 	}
 	http.Handle("/metrics", handler)
-	if err := httpServer.ListenAndServeTLS(crtFile, keyFile); err != nil {
-		log.Error(err, "error in HTTP listen", "addr", addr)
-		os.Exit(1)
+	// Probes are not authenticated, they don't expose any data.
+	http.Handle("/healthz", checks.LivenessHandler())
+	http.Handle("/readyz", checks.ReadinessHandler())
+	go func() {
+		// The certificate is provided by TLSConfig.GetCertificate.
+		if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Error(err, "error in HTTP listen", "addr", addr)
+			failed()
+		}
+	}()
+
+	var enricher logwatch.Enricher
+	if cfg.Enrich != nil {
+		e, err := newEnricher(nodeName, *cfg.Enrich)
+		if err != nil {
+			log.Error(err, "error starting pod metadata enrichment")
+			os.Exit(1)
+		}
+		defer e.Close()
+		log.Info("pod metadata enrichment enabled", "nodeName", nodeName, "labels", e.LabelNames())
+		enricher = e
+	}
+
+	watchers := map[string]*logwatch.Watcher{}
+	watching := sync.WaitGroup{}
+	for _, root := range cfg.WatchRoots(dir) {
+		log.Info("start log metric exporter", "path", root.Dir, "metricPrefix", root.MetricPrefix)
+		opts := logwatch.Options{
+			PollInterval:      watcherPollInterval,
+			Fanotify:          backend == "fanotify",
+			Workers:           workers,
+			CoalesceDelay:     coalesceDelay,
+			Checkpoint:        checkpoint,
+			MetricPrefix:      root.MetricPrefix,
+			Rules:             root.LabelRules,
+			Filter:            root.Filter,
+			MaxSeries:         cfg.MaxSeries,
+			ReconcileInterval: cfg.ReconcileInterval.Duration,
+			SeriesTTL:         cfg.SeriesTTL.Duration,
+			Aggregate:         cfg.Aggregate,
+			Enricher:          enricher,
+		}
+		if len(positions) > 0 {
+			opts.Positions = positions
+		}
+		w, err := logwatch.New(root.Dir, opts)
+		if err != nil {
+			log.Error(err, "watch error", "path", root.Dir)
+			os.Exit(1)
+		}
+		defer w.Close()
+		watchers[root.Dir] = w
+		checks.AddLiveness(root.Dir, func() error { return w.Healthy(progressDeadline) })
+		watching.Add(1)
+		go func(dir string) {
+			defer watching.Done()
+			if err := w.Watch(ctx); err != nil {
+				log.Error(err, "error in watch", "path", dir)
+				failed()
+			}
+		}(root.Dir)
+	}
+	started.Store(true)
+	if checkpointFile != "" {
+		go saveCheckpoints(ctx, watchers, checkpointFile, checkpointInterval)
+	}
+	if configFile != "" {
+		reload := func() { reloadFilters(configFile, dir, watchers) }
+		fw, err := filewatch.New([]string{configFile}, reload)
+		if err != nil {
+			log.Error(err, "error watching configuration", "path", configFile)
+			os.Exit(1)
+		}
+		defer fw.Close()
+		go func() {
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			for range hup {
+				reload()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Info("shutting down", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if !waitTimeout(shutdownCtx, &watching) {
+		log.Info("timed out processing queued events")
+	}
+	if checkpointFile != "" {
+		saveCheckpoint(watchers, checkpointFile)
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error(err, "error shutting down HTTP server", "addr", addr)
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -52,7 +53,7 @@ func TestScrapeMetrics(t *testing.T) {
 	}
 
 	// Write to log and scrape metric till eventually the exporter has updated the metric.
-	data := []byte("hello\n")
+	data := []byte("2021-06-03T14:22:36.000000000+00:00 stdout F hello\n")
 	require.Eventually(t, func() bool {
 		require.NoError(t, os.WriteFile(path, data, 0600))
 		if m := findMetric(); m != nil {
@@ -62,6 +63,7 @@ func TestScrapeMetrics(t *testing.T) {
 				"namespace":     "test-qegihyox",
 				"podname":       "functional",
 				"poduuid":       "19b40c1b-df6d-4e63-b5aa-d6c5ed20ac4e",
+				"stream":        "stdout",
 			})
 			return true
 		}
@@ -73,7 +75,7 @@ func TestScrapeMetrics(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	assert.Eventually(t, func() bool {
-		_, err = f.WriteString("more data\n")
+		_, err = f.WriteString("2021-06-03T14:22:37.000000000+00:00 stdout F more data\n")
 		require.NoError(t, err)
 		m := findMetric()
 		return m != nil && *m.Counter.Value > float64(len(data))
@@ -84,6 +86,22 @@ func TestScrapeMetrics(t *testing.T) {
 	require.Eventually(t, func() bool { return findMetric() == nil }, 10*time.Second, time.Second/10)
 }
 
+// Test that the probe endpoints eventually report the exporter healthy and ready, without authentication.
+func TestProbes(t *testing.T) {
+	runMain(t, t.TempDir())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		assert.Eventually(t, func() bool {
+			resp, err := client.Get("https://localhost:2112" + path)
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, 10*time.Second, time.Second/10, path)
+	}
+}
+
 func TestParseTLSGroups(t *testing.T) {
 	tests := []struct {
 		name     string
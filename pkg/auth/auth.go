@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	log "github.com/ViaQ/logerr/v2/log/static"
 	authenticationv1 "k8s.io/api/authentication/v1"
@@ -16,6 +17,7 @@ import (
 // using the Kubernetes TokenReview and SubjectAccessReview APIs.
 type KubeAuthenticator struct {
 	clientset kubernetes.Interface
+	cache     *ReviewCache // Nil if results are not cached.
 }
 
 // NewKubeAuthenticator creates a KubeAuthenticator using in-cluster configuration.
@@ -40,9 +42,22 @@ func NewKubeAuthenticatorWithClient(clientset kubernetes.Interface) *KubeAuthent
 	return &KubeAuthenticator{clientset: clientset}
 }
 
+// SetCache caches review results in c, results are not cached if c is nil.
+func (a *KubeAuthenticator) SetCache(c *ReviewCache) {
+	a.cache = c
+}
+
 // Authenticate validates a bearer token by submitting a TokenReview to the Kubernetes API.
 // Returns the authenticated user info on success, or an error if the token is invalid.
 func (a *KubeAuthenticator) Authenticate(ctx context.Context, token string) (*authenticationv1.TokenReviewStatus, error) {
+	if a.cache != nil {
+		if status, ok := a.cache.token(token); ok {
+			if status == nil {
+				return nil, fmt.Errorf("token is not authenticated")
+			}
+			return status, nil
+		}
+	}
 	review, err := a.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
 		Spec: authenticationv1.TokenReviewSpec{
 			Token: token,
@@ -53,16 +68,40 @@ func (a *KubeAuthenticator) Authenticate(ctx context.Context, token string) (*au
 	}
 
 	if !review.Status.Authenticated {
+		if a.cache != nil {
+			a.cache.setToken(token, nil)
+		}
 		return nil, fmt.Errorf("token is not authenticated")
 	}
+	if a.cache != nil {
+		a.cache.setToken(token, &review.Status)
+	}
 
 	log.V(3).Info("authenticated request", "user", review.Status.User.Username)
 	return &review.Status, nil
 }
 
+// AuthenticateRequest validates the bearer token of a request, see Authenticate.
+func (a *KubeAuthenticator) AuthenticateRequest(r *http.Request) (*User, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.Authenticate(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return &User{Name: status.User.Username, Groups: status.User.Groups}, nil
+}
+
 // Authorize checks whether the given user is allowed to perform the specified action
 // on a non-resource URL by submitting a SubjectAccessReview to the Kubernetes API.
 func (a *KubeAuthenticator) Authorize(ctx context.Context, username string, groups []string, verb string, path string) (bool, string, error) {
+	if a.cache != nil {
+		if r, ok := a.cache.accessReview(username, groups, verb, path); ok {
+			return r.allowed, r.reason, nil
+		}
+	}
 	review, err := a.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
 		Spec: authorizationv1.SubjectAccessReviewSpec{
 			User:   username,
@@ -77,5 +116,8 @@ func (a *KubeAuthenticator) Authorize(ctx context.Context, username string, grou
 		return false, "", fmt.Errorf("subject access review failed: %w", err)
 	}
 
+	if a.cache != nil {
+		a.cache.setAccessReview(username, groups, verb, path, accessReview{allowed: review.Status.Allowed, reason: review.Status.Reason})
+	}
 	return review.Status.Allowed, review.Status.Reason, nil
 }
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// User is an authenticated user.
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Authenticator identifies the user making a request.
+type Authenticator interface {
+	// AuthenticateRequest returns the user making the request, or an error if the request is not authenticated.
+	AuthenticateRequest(r *http.Request) (*User, error)
+}
+
+// Authorizer checks whether a user is allowed to perform an action on a path.
+type Authorizer interface {
+	// Authorize returns whether the user is allowed, with the reason if available.
+	Authorize(ctx context.Context, username string, groups []string, verb string, path string) (bool, string, error)
+}
+
+var (
+	_ Authenticator = &KubeAuthenticator{}
+	_ Authorizer    = &KubeAuthenticator{}
+	_ Authenticator = &TokenFile{}
+	_ Authenticator = &Htpasswd{}
+)
+
+var errNoCredentials = errors.New("no credentials")
+
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", errNoCredentials
+	}
+	return token, nil
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// ReviewCache caches the results of TokenReviews by token hash, and of SubjectAccessReviews by user and path,
+// to avoid calling the Kubernetes API for every scrape.
+// Successful results are kept for the positive TTL, rejections for the negative TTL. Errors are not cached.
+type ReviewCache struct {
+	positiveTTL, negativeTTL time.Duration
+	mutex                    sync.Mutex
+	tokens                   map[[sha256.Size]byte]cached[*authenticationv1.TokenReviewStatus]
+	access                   map[string]cached[accessReview]
+	nextPrune                time.Time
+	requests                 *prometheus.CounterVec
+	now                      func() time.Time
+}
+
+type cached[T any] struct {
+	value   T
+	expires time.Time
+}
+
+type accessReview struct {
+	allowed bool
+	reason  string
+}
+
+// NewReviewCache creates a cache and its <metricPrefix>auth_cache_requests_total metric,
+// ReviewCache is a prometheus.Collector for the metric.
+func NewReviewCache(positiveTTL, negativeTTL time.Duration, metricPrefix string) *ReviewCache {
+	return &ReviewCache{
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		tokens:      map[[sha256.Size]byte]cached[*authenticationv1.TokenReviewStatus]{},
+		access:      map[string]cached[accessReview]{},
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: metricPrefix + "auth_cache_requests_total",
+			Help: "Total number of authentication (token) and authorization (access) cache lookups, by cache and result: hit or miss",
+		}, []string{"cache", "result"}),
+		now: time.Now,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ReviewCache) Describe(ch chan<- *prometheus.Desc) { c.requests.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (c *ReviewCache) Collect(ch chan<- prometheus.Metric) { c.requests.Collect(ch) }
+
+// ttl returns the time to keep a positive or negative result.
+func (c *ReviewCache) ttl(positive bool) time.Duration {
+	if positive {
+		return c.positiveTTL
+	}
+	return c.negativeTTL
+}
+
+// token returns the cached TokenReview status of token, nil if the token was not authenticated.
+func (c *ReviewCache) token(token string) (status *authenticationv1.TokenReviewStatus, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return lookup(c, c.tokens, sha256.Sum256([]byte(token)), "token")
+}
+
+// setToken caches the TokenReview status of token, nil if the token was not authenticated.
+func (c *ReviewCache) setToken(token string, status *authenticationv1.TokenReviewStatus) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	store(c, c.tokens, sha256.Sum256([]byte(token)), status, status != nil)
+}
+
+// accessKey identifies a SubjectAccessReview.
+func accessKey(username string, groups []string, verb, path string) string {
+	return strings.Join([]string{username, strings.Join(groups, ","), verb, path}, "\x00")
+}
+
+// accessReview returns the cached SubjectAccessReview result.
+func (c *ReviewCache) accessReview(username string, groups []string, verb, path string) (accessReview, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return lookup(c, c.access, accessKey(username, groups, verb, path), "access")
+}
+
+// setAccessReview caches a SubjectAccessReview result.
+func (c *ReviewCache) setAccessReview(username string, groups []string, verb, path string, review accessReview) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	store(c, c.access, accessKey(username, groups, verb, path), review, review.allowed)
+}
+
+// lookup returns an unexpired entry and counts the hit or miss, must be called with the mutex locked.
+func lookup[K comparable, T any](c *ReviewCache, m map[K]cached[T], key K, name string) (value T, ok bool) {
+	e, ok := m[key]
+	if ok && c.now().Before(e.expires) {
+		c.requests.WithLabelValues(name, "hit").Inc()
+		return e.value, true
+	}
+	c.requests.WithLabelValues(name, "miss").Inc()
+	return value, false
+}
+
+// store an entry if its TTL is not 0, must be called with the mutex locked.
+// Expired entries are pruned at most once per positive TTL, so the cache does not grow with old tokens.
+func store[K comparable, T any](c *ReviewCache, m map[K]cached[T], key K, value T, positive bool) {
+	now := c.now()
+	if now.After(c.nextPrune) {
+		c.prune(now)
+		c.nextPrune = now.Add(max(c.positiveTTL, c.negativeTTL))
+	}
+	if ttl := c.ttl(positive); ttl > 0 {
+		m[key] = cached[T]{value: value, expires: now.Add(ttl)}
+	}
+}
+
+// prune deletes expired entries, must be called with the mutex locked.
+func (c *ReviewCache) prune(now time.Time) {
+	for k, e := range c.tokens {
+		if !now.Before(e.expires) {
+			delete(c.tokens, k)
+		}
+	}
+	for k, e := range c.access {
+		if !now.Before(e.expires) {
+			delete(c.access, k)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newCountingAuthenticator returns an authenticator with a cache and a fake clock,
+// that accepts the token "valid" and allows the path "/metrics", and counts the reviews.
+func newCountingAuthenticator(reviews *int) (*KubeAuthenticator, *ReviewCache, *time.Time) {
+	fakeClient := fake.NewSimpleClientset()
+	fakeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+		token := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).Spec.Token
+		return true, &authenticationv1.TokenReview{
+			Status: authenticationv1.TokenReviewStatus{
+				Authenticated: token == "valid",
+				User:          authenticationv1.UserInfo{Username: "user"},
+			},
+		}, nil
+	})
+	fakeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+		path := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).Spec.NonResourceAttributes.Path
+		return true, &authorizationv1.SubjectAccessReview{
+			Status: authorizationv1.SubjectAccessReviewStatus{Allowed: path == "/metrics"},
+		}, nil
+	})
+	now := time.Now()
+	cache := NewReviewCache(time.Minute, time.Second, "test_")
+	cache.now = func() time.Time { return now }
+	a := NewKubeAuthenticatorWithClient(fakeClient)
+	a.SetCache(cache)
+	return a, cache, &now
+}
+
+func TestReviewCache_Authenticate(t *testing.T) {
+	reviews := 0
+	a, cache, now := newCountingAuthenticator(&reviews)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if status, err := a.Authenticate(ctx, "valid"); err != nil || status.User.Username != "user" {
+			t.Fatalf("expected user, got %v, %v", status, err)
+		}
+		if _, err := a.Authenticate(ctx, "invalid"); err == nil {
+			t.Fatal("expected error for invalid token")
+		}
+	}
+	if reviews != 2 {
+		t.Errorf("expected 2 reviews, got %d", reviews)
+	}
+
+	// The negative result expires first.
+	*now = now.Add(2 * time.Second)
+	_, _ = a.Authenticate(ctx, "valid")
+	_, _ = a.Authenticate(ctx, "invalid")
+	if reviews != 3 {
+		t.Errorf("expected 3 reviews, got %d", reviews)
+	}
+	*now = now.Add(time.Minute)
+	_, _ = a.Authenticate(ctx, "valid")
+	if reviews != 4 {
+		t.Errorf("expected 4 reviews, got %d", reviews)
+	}
+
+	if hits := testutil.ToFloat64(cache.requests.WithLabelValues("token", "hit")); hits != 5 {
+		t.Errorf("expected 5 hits, got %v", hits)
+	}
+	if misses := testutil.ToFloat64(cache.requests.WithLabelValues("token", "miss")); misses != 4 {
+		t.Errorf("expected 4 misses, got %v", misses)
+	}
+}
+
+func TestReviewCache_Authorize(t *testing.T) {
+	reviews := 0
+	a, _, now := newCountingAuthenticator(&reviews)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, err := a.Authorize(ctx, "user", nil, "get", "/metrics"); err != nil || !allowed {
+			t.Fatalf("expected allowed, got %v, %v", allowed, err)
+		}
+		if allowed, _, err := a.Authorize(ctx, "user", nil, "get", "/other"); err != nil || allowed {
+			t.Fatalf("expected denied, got %v, %v", allowed, err)
+		}
+	}
+	// Another user is reviewed separately.
+	_, _, _ = a.Authorize(ctx, "other", nil, "get", "/metrics")
+	if reviews != 3 {
+		t.Errorf("expected 3 reviews, got %d", reviews)
+	}
+
+	*now = now.Add(2 * time.Second)
+	_, _, _ = a.Authorize(ctx, "user", nil, "get", "/metrics")
+	_, _, _ = a.Authorize(ctx, "user", nil, "get", "/other")
+	if reviews != 4 {
+		t.Errorf("expected 4 reviews, got %d", reviews)
+	}
+}
+
+func TestReviewCache_Prune(t *testing.T) {
+	reviews := 0
+	a, cache, now := newCountingAuthenticator(&reviews)
+	_, _ = a.Authenticate(context.Background(), "valid")
+	*now = now.Add(2 * time.Minute)
+	_, _ = a.Authenticate(context.Background(), "invalid")
+	if len(cache.tokens) != 1 {
+		t.Errorf("expected expired token to be pruned, got %d tokens", len(cache.tokens))
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func clientCertRequest(cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return req
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "prometheus", Organization: []string{"monitoring"}},
+		DNSNames: []string{"prometheus.example.com"},
+	}
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		cert     *x509.Certificate
+		fallback http.Handler
+		expected int
+	}{
+		{name: "any verified certificate", cert: cert, expected: http.StatusOK},
+		{name: "allowed common name", allowed: []string{"prometheus"}, cert: cert, expected: http.StatusOK},
+		{name: "allowed subject", allowed: []string{"CN=prometheus,O=monitoring"}, cert: cert, expected: http.StatusOK},
+		{name: "allowed DNS SAN", allowed: []string{"prometheus.example.com"}, cert: cert, expected: http.StatusOK},
+		{name: "name not allowed", allowed: []string{"other"}, cert: cert, expected: http.StatusForbidden},
+		{name: "no certificate", expected: http.StatusUnauthorized},
+		{name: "no certificate with fallback", fallback: fallback, expected: http.StatusTeapot},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ClientCertMiddleware(tc.allowed, okHandler(), tc.fallback).ServeHTTP(w, clientCertRequest(tc.cert))
+			if w.Code != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestLoadClientCAs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadClientCAs(path); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadClientCAs(path); err == nil {
+		t.Error("expected error for a file without certificates")
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd authenticates HTTP basic auth credentials listed in an htpasswd file, reloaded when the file changes.
+//
+// The file has a line per user, user:hash. Passwords must be hashed with bcrypt, e.g. with "htpasswd -B".
+// Lines starting with # are ignored.
+type Htpasswd struct {
+	file *reloadingFile[htpasswdUsers]
+}
+
+type htpasswdUsers struct {
+	hashes map[string][]byte
+	// dummy is a hash with the cost of the users' hashes, checked for unknown users
+	// so that the response time doesn't reveal which users exist.
+	dummy []byte
+}
+
+// NewHtpasswd loads the htpasswd file at path and starts watching it.
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	f, err := loadFile(path, parseHtpasswd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load htpasswd file: %w", err)
+	}
+	return &Htpasswd{file: f}, nil
+}
+
+// Close stops watching the htpasswd file.
+func (h *Htpasswd) Close() error { return h.file.close() }
+
+// AuthenticateRequest returns the user of the basic auth credentials of a request.
+func (h *Htpasswd) AuthenticateRequest(r *http.Request) (*User, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errNoCredentials
+	}
+	users := h.file.get()
+	hash, known := users.hashes[name]
+	if !known {
+		hash = users.dummy
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !known {
+		return nil, errors.New("invalid user or password")
+	}
+	return &User{Name: name}, nil
+}
+
+// parseHtpasswd returns the password hashes of an htpasswd file by user.
+func parseHtpasswd(data []byte) (htpasswdUsers, error) {
+	users := htpasswdUsers{hashes: map[string][]byte{}}
+	cost := bcrypt.DefaultCost
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return users, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		c, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return users, fmt.Errorf("line %d: unsupported hash for user %q, passwords must be hashed with bcrypt: %w", n, name, err)
+		}
+		cost = c
+		users.hashes[name] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return users, err
+	}
+	var err error
+	users.dummy, err = bcrypt.GenerateFromPassword([]byte("dummy"), cost)
+	return users, err
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func basicRequest(user, password string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth(user, password)
+	return req
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// htpasswd -B writes the $2y$ prefix.
+	apacheHash := strings.Replace(string(hash), "$2a$", "$2y$", 1)
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	data := "# users allowed to scrape metrics\nprometheus:" + string(hash) + "\napache:" + apacheHash + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+
+	for _, name := range []string{"prometheus", "apache"} {
+		user, err := h.AuthenticateRequest(basicRequest(name, "secret"))
+		if err != nil {
+			t.Errorf("expected %v to be authenticated, got %v", name, err)
+		} else if user.Name != name {
+			t.Errorf("expected %v, got %v", name, user.Name)
+		}
+		if _, err := h.AuthenticateRequest(basicRequest(name, "wrong")); err == nil {
+			t.Errorf("expected error for wrong password of %v", name)
+		}
+	}
+	if _, err := h.AuthenticateRequest(basicRequest("unknown", "secret")); err == nil {
+		t.Error("expected error for unknown user")
+	}
+	if _, err := h.AuthenticateRequest(bearerRequest("secret")); err == nil {
+		t.Error("expected error without basic auth")
+	}
+	if cost, err := bcrypt.Cost(h.file.get().dummy); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("expected dummy hash with the users' cost, got %v, %v", cost, err)
+	}
+}
+
+func TestParseHtpasswd_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"no-separator\n",
+		":$2y$05$abcdefghijklmnopqrstuu5Ew2U0e0IhBZ1SxxcYhb5hFBo5yOhPy\n",
+		"sha1:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n",
+		"md5:$apr1$abcdefgh$7SVJyMyC7e9YhaD1t7uoq/\n",
+		"sha512:$6$abcdefgh$ltjgWl6579NluT/Vi1nwEvcil.G5Nbc4NiXZaNGStk8PSwGfQv72N2CKPPrVACtLtip/cZ/1GM/O6IND4WQhG.\n",
+		"plain:secret\n",
+	} {
+		if _, err := parseHtpasswd([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
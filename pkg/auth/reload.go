@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"os"
+	"sync/atomic"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/log-file-metric-exporter/pkg/filewatch"
+)
+
+// reloadingFile holds the parsed content of a file, reloaded when the file changes.
+type reloadingFile[T any] struct {
+	path    string
+	parse   func([]byte) (T, error)
+	value   atomic.Pointer[T]
+	watcher *filewatch.Watcher
+}
+
+// loadFile parses path and starts watching it.
+func loadFile[T any](path string, parse func([]byte) (T, error)) (*reloadingFile[T], error) {
+	f := &reloadingFile[T]{path: path, parse: parse}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := filewatch.New([]string{path}, func() {
+		if err := f.reload(); err != nil {
+			log.Error(err, "error reloading file, keeping previous content", "path", path)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.watcher = watcher
+	return f, nil
+}
+
+// reload parses the file, the previous content is kept if it can't be parsed.
+func (f *reloadingFile[T]) reload() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		return err
+	}
+	f.value.Store(&value)
+	log.V(1).Info("loaded file", "path", f.path)
+	return nil
+}
+
+// get returns the current content.
+func (f *reloadingFile[T]) get() T { return *f.value.Load() }
+
+// close stops watching the file.
+func (f *reloadingFile[T]) close() error { return f.watcher.Close() }
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TokenFile authenticates bearer tokens listed in a static token file, reloaded when the file changes.
+//
+// The file has the CSV format of the Kubernetes API server --token-auth-file option,
+// a line per token with at least 2 columns: token,user,uid,"group1,group2". The uid is ignored.
+type TokenFile struct {
+	file *reloadingFile[map[[sha256.Size]byte]User]
+}
+
+// NewTokenFile loads the token file at path and starts watching it.
+func NewTokenFile(path string) (*TokenFile, error) {
+	f, err := loadFile(path, parseTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token file: %w", err)
+	}
+	return &TokenFile{file: f}, nil
+}
+
+// Close stops watching the token file.
+func (t *TokenFile) Close() error { return t.file.close() }
+
+// AuthenticateRequest returns the user of the bearer token of a request.
+func (t *TokenFile) AuthenticateRequest(r *http.Request) (*User, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens are looked up by hash, so the lookup time doesn't depend on how much of a token matches.
+	user, ok := t.file.get()[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, errors.New("unknown token")
+	}
+	return &user, nil
+}
+
+// parseTokenFile returns the users of a token file by token hash.
+func parseTokenFile(data []byte) (map[[sha256.Size]byte]User, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	users := map[[sha256.Size]byte]User{}
+	for i, record := range records {
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("line %d: expected token and user", i+1)
+		}
+		key := sha256.Sum256([]byte(record[0]))
+		if _, ok := users[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate token", i+1)
+		}
+		user := User{Name: record[1]}
+		if len(record) > 3 && record[3] != "" {
+			user.Groups = strings.Split(record[3], ",")
+		}
+		users[key] = user
+	}
+	return users, nil
+}
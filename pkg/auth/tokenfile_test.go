@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	if err := os.WriteFile(path, []byte("token1,prometheus,uid1,\"monitoring,readers\"\ntoken2,scraper\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := NewTokenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tokens.Close() })
+
+	user, err := tokens.AuthenticateRequest(bearerRequest("token1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&User{Name: "prometheus", Groups: []string{"monitoring", "readers"}}); !reflect.DeepEqual(expected, user) {
+		t.Errorf("expected %v, got %v", expected, user)
+	}
+	if _, err := tokens.AuthenticateRequest(bearerRequest("unknown")); err == nil {
+		t.Error("expected error for unknown token")
+	}
+	if _, err := tokens.AuthenticateRequest(httptest.NewRequest(http.MethodGet, "/metrics", nil)); err == nil {
+		t.Error("expected error without token")
+	}
+
+	// The file is reloaded when it changes, an invalid file keeps the previous tokens.
+	if err := os.WriteFile(path, []byte("token3,other\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for _, err := tokens.AuthenticateRequest(bearerRequest("token3")); err != nil; _, err = tokens.AuthenticateRequest(bearerRequest("token3")) {
+		if time.Now().After(deadline) {
+			t.Fatal("token file was not reloaded")
+		}
+		time.Sleep(time.Second / 20)
+	}
+	if _, err := tokens.AuthenticateRequest(bearerRequest("token1")); err == nil {
+		t.Error("expected error for removed token")
+	}
+}
+
+func TestParseTokenFile_Invalid(t *testing.T) {
+	for _, data := range []string{"token-without-user\n", ",user\n", "token,a\ntoken,b\n", "\"unterminated\n"} {
+		if _, err := parseTokenFile([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package certwatch serves a TLS certificate and key that are reloaded when their files change,
+// e.g. when the service-ca operator rotates the serving certificate in a Kubernetes Secret volume.
+package certwatch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync/atomic"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/log-file-metric-exporter/pkg/filewatch"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Watcher holds the certificate loaded from a certificate and key file, and reloads it when the files change.
+type Watcher struct {
+	crtFile, keyFile string
+	cert             atomic.Pointer[tls.Certificate]
+	watcher          *filewatch.Watcher
+}
+
+// New loads the certificate and key, and starts watching their files.
+func New(crtFile, keyFile string) (*Watcher, error) {
+	w := &Watcher{crtFile: crtFile, keyFile: keyFile}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := filewatch.New([]string{crtFile, keyFile}, func() {
+		if err := w.Reload(); err != nil {
+			// The files may be updated one at a time, the next change reloads the matching pair.
+			log.Error(err, "error reloading TLS certificate, keeping previous certificate", "crtFile", crtFile, "keyFile", keyFile)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.watcher = watcher
+	return w, nil
+}
+
+// Close stops watching the files.
+func (w *Watcher) Close() error { return w.watcher.Close() }
+
+// Reload loads the certificate and key files, the previous certificate is kept if they can't be loaded.
+func (w *Watcher) Reload() error {
+	cert, err := tls.LoadX509KeyPair(w.crtFile, w.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	w.cert.Store(&cert)
+	log.Info("loaded TLS certificate", "crtFile", w.crtFile, "subject", cert.Leaf.Subject.String(), "notAfter", cert.Leaf.NotAfter)
+	return nil
+}
+
+// Certificate returns the current certificate.
+func (w *Watcher) Certificate() *tls.Certificate { return w.cert.Load() }
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate.
+func (w *Watcher) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return w.Certificate(), nil
+}
+
+// ExpiryMetric returns a gauge named <prefix>tls_certificate_expiry_timestamp_seconds,
+// the expiry time of the current certificate in seconds since the epoch.
+func (w *Watcher) ExpiryMetric(prefix string) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        prefix + "tls_certificate_expiry_timestamp_seconds",
+		Help:        "Expiry time of the TLS serving certificate in seconds since the epoch",
+		ConstLabels: prometheus.Labels{"file": w.crtFile},
+	}, func() float64 { return float64(w.Certificate().Leaf.NotAfter.Unix()) })
+}
@@ -0,0 +1,68 @@
+package certwatch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for name expiring at notAfter, and its key.
+func writeCert(t *testing.T, crtFile, keyFile, name string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.WriteFile(crtFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	crtFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	writeCert(t, crtFile, keyFile, "first", expiry)
+
+	w, err := New(crtFile, keyFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+	cert, err := w.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+	assert.Equal(t, float64(expiry.Unix()), testutil.ToFloat64(w.ExpiryMetric("test_")))
+
+	writeCert(t, crtFile, keyFile, "second", expiry.Add(time.Hour))
+	assert.Eventually(t, func() bool { return w.Certificate().Leaf.Subject.CommonName == "second" }, 2*time.Second, time.Second/10)
+	assert.Equal(t, float64(expiry.Add(time.Hour).Unix()), testutil.ToFloat64(w.ExpiryMetric("test_")))
+
+	// A broken key file keeps the previous certificate.
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.Error(t, w.Reload())
+	assert.Equal(t, "second", w.Certificate().Leaf.Subject.CommonName)
+}
+
+func TestNewError(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	assert.Error(t, err)
+}
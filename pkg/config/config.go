@@ -0,0 +1,146 @@
+// Package config loads the exporter configuration file.
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/log-file-metric-exporter/pkg/enrich"
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var metricPrefix = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Config is the exporter configuration, loaded from a YAML or JSON file.
+type Config struct {
+	// LabelRules extract metric labels from log file paths, see logwatch.Rule.
+	// Used for roots that have no rules of their own, the default rules for /var/log/pods are used if empty.
+	LabelRules logwatch.Rules `json:"labelRules,omitempty"`
+	// Filter selects the containers to watch, used for roots that have no filter of their own.
+	// The filter can be changed without restarting the exporter.
+	Filter *logwatch.Filter `json:"filter,omitempty"`
+	// MaxSeries is the maximum number of containers with their own series in each root, unlimited if 0.
+	// Containers beyond the limit are counted in an "__overflow__" series.
+	MaxSeries int `json:"maxSeries,omitempty"`
+	// ReconcileInterval is the interval between walks of the watched directories that recover from missed
+	// file system events, e.g. "10m". Disabled if 0, directories are still walked when events are lost.
+	ReconcileInterval metav1.Duration `json:"reconcileInterval,omitempty"`
+	// SeriesTTL is the time after which the series of a container whose files have not changed are deleted,
+	// e.g. "24h". Series of files that no longer exist are also deleted. Disabled if 0.
+	SeriesTTL metav1.Duration `json:"seriesTTL,omitempty"`
+	// Aggregate enables metrics of the logged bytes summed by namespace, and by workload if Enrich is set.
+	Aggregate bool `json:"aggregate,omitempty"`
+	// Enrich adds Pod metadata from the Kubernetes API as metric labels, disabled if nil.
+	Enrich *enrich.Config `json:"enrich,omitempty"`
+	// Roots are the directories to watch. If empty, the directory given by the -dir flag is watched.
+	Roots []Root `json:"roots,omitempty"`
+}
+
+// Root is a directory tree of log files.
+type Root struct {
+	Dir string `json:"dir"`
+	// MetricPrefix of the metric names for files in this root, logwatch.DefaultMetricPrefix if empty.
+	// Each root must have a different prefix.
+	MetricPrefix string `json:"metricPrefix,omitempty"`
+	// LabelRules for files in this root, the top level LabelRules if empty.
+	LabelRules logwatch.Rules `json:"labelRules,omitempty"`
+	// Filter for containers in this root, the top level Filter if nil.
+	Filter *logwatch.Filter `json:"filter,omitempty"`
+}
+
+// Load reads and validates a configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration %v: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %v: %w", path, err)
+	}
+	return c, nil
+}
+
+// Validate the configuration, and compile the label rules.
+func (c *Config) Validate() error {
+	if len(c.LabelRules) > 0 {
+		if err := c.LabelRules.Compile(); err != nil {
+			return err
+		}
+	}
+	if c.Filter != nil {
+		if err := c.Filter.Compile(); err != nil {
+			return err
+		}
+	}
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("invalid maxSeries %v", c.MaxSeries)
+	}
+	if c.ReconcileInterval.Duration < 0 {
+		return fmt.Errorf("invalid reconcileInterval %v", c.ReconcileInterval.Duration)
+	}
+	if c.SeriesTTL.Duration < 0 {
+		return fmt.Errorf("invalid seriesTTL %v", c.SeriesTTL.Duration)
+	}
+	if c.Enrich != nil {
+		if err := c.Enrich.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.Roots) == 0 {
+		return nil
+	}
+	prefixes := map[string]bool{}
+	for _, r := range c.WatchRoots("") {
+		if r.Dir == "" {
+			return fmt.Errorf("root has no directory")
+		}
+		if !metricPrefix.MatchString(r.MetricPrefix) {
+			return fmt.Errorf("invalid metric prefix %q: %v", r.MetricPrefix, r.Dir)
+		}
+		if prefixes[r.MetricPrefix] {
+			return fmt.Errorf("duplicate metric prefix %q: %v", r.MetricPrefix, r.Dir)
+		}
+		prefixes[r.MetricPrefix] = true
+		if len(r.LabelRules) > 0 {
+			if err := r.LabelRules.Compile(); err != nil {
+				return fmt.Errorf("%w: %v", err, r.Dir)
+			}
+		}
+		if r.Filter != nil {
+			if err := r.Filter.Compile(); err != nil {
+				return fmt.Errorf("%w: %v", err, r.Dir)
+			}
+		}
+	}
+	return nil
+}
+
+// WatchRoots returns the roots to watch with defaults filled in.
+// If the configuration has no roots, returns a single root for defaultDir.
+func (c *Config) WatchRoots(defaultDir string) []Root {
+	roots := c.Roots
+	if len(roots) == 0 {
+		roots = []Root{{Dir: defaultDir}}
+	}
+	filled := make([]Root, len(roots))
+	for i, r := range roots {
+		if r.MetricPrefix == "" {
+			r.MetricPrefix = logwatch.DefaultMetricPrefix
+		}
+		if len(r.LabelRules) == 0 {
+			r.LabelRules = c.LabelRules
+		}
+		if r.Filter == nil {
+			r.Filter = c.Filter
+		}
+		filled[i] = r
+	}
+	return filled
+}
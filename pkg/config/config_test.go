@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(text), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(writeConfig(t, `
+labelRules:
+- pattern: '/var/log/containers/(?P<podname>[^_]+)_(?P<namespace>[^_]+)_(?P<containername>.+)-[0-9a-f]{64}\.log$'
+- pattern: '/var/log/app/(?P<containername>[^/]+)\.log$'
+`))
+	require.NoError(t, err)
+	require.Len(t, c.LabelRules, 2)
+
+	var l logwatch.LogLabels
+	assert.True(t, c.LabelRules.Parse("/var/log/app/billing.log", &l))
+	assert.Equal(t, logwatch.LogLabels{Container: "billing"}, l)
+	assert.True(t, c.LabelRules.Parse("/var/log/containers/mypod_myns_mycontainer-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.log", &l))
+	assert.Equal(t, logwatch.LogLabels{Namespace: "myns", Name: "mypod", Container: "mycontainer"}, l)
+	assert.False(t, c.LabelRules.Parse("/var/log/messages", &l))
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, text := range map[string]string{
+		"bad regexp":    `labelRules: [{pattern: "(?P<namespace>"}]`,
+		"unknown label": `labelRules: [{pattern: "(?P<pod>.*)"}]`,
+		"no labels":     `labelRules: [{pattern: ".*"}]`,
+		"unknown field": `labelRule: []`,
+		"max series":    `maxSeries: -1`,
+		"series ttl":    `seriesTTL: -1h`,
+		"reconcile":     `reconcileInterval: -1m`,
+		"enrich":        `enrich: {podLabels: [""]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, text))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRoots(t *testing.T) {
+	c, err := Load(writeConfig(t, `
+labelRules:
+- pattern: '/(?P<namespace>[^_/]+)_(?P<podname>[^_/]+)_(?P<poduuid>[^_/]+)/(?P<containername>[^/]+)/[0-9]+\.log$'
+roots:
+- dir: /var/log/pods
+- dir: /var/log/kube-apiserver
+  metricPrefix: audit_log_
+  labelRules:
+  - pattern: '/var/log/(?P<containername>[^/]+)/audit\.log$'
+`))
+	require.NoError(t, err)
+	roots := c.WatchRoots("/ignored")
+	require.Len(t, roots, 2)
+	assert.Equal(t, "/var/log/pods", roots[0].Dir)
+	assert.Equal(t, logwatch.DefaultMetricPrefix, roots[0].MetricPrefix)
+	assert.Equal(t, c.LabelRules, roots[0].LabelRules)
+	assert.Equal(t, "/var/log/kube-apiserver", roots[1].Dir)
+	assert.Equal(t, "audit_log_", roots[1].MetricPrefix)
+	var l logwatch.LogLabels
+	assert.True(t, roots[1].LabelRules.Parse("/var/log/kube-apiserver/audit.log", &l))
+	assert.Equal(t, logwatch.LogLabels{Container: "kube-apiserver"}, l)
+
+	c = &Config{}
+	assert.Equal(t, []Root{{Dir: "/var/log/pods", MetricPrefix: logwatch.DefaultMetricPrefix}}, c.WatchRoots("/var/log/pods"))
+}
+
+func TestLoadInvalidRoots(t *testing.T) {
+	for name, text := range map[string]string{
+		"no dir":           `roots: [{metricPrefix: "x_"}]`,
+		"duplicate prefix": `roots: [{dir: /a}, {dir: /b}]`,
+		"invalid prefix":   `roots: [{dir: /a, metricPrefix: "a-b"}]`,
+		"invalid rules":    `roots: [{dir: /a, labelRules: [{pattern: ".*"}]}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, text))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadFilter(t *testing.T) {
+	c, err := Load(writeConfig(t, `
+filter:
+  namespaces:
+    exclude: ['openshift-*', '/^kube-/']
+roots:
+- dir: /var/log/pods
+- dir: /var/log/app
+  metricPrefix: app_
+  filter:
+    containers:
+      include: [billing]
+`))
+	require.NoError(t, err)
+	roots := c.WatchRoots("")
+	assert.Same(t, c.Filter, roots[0].Filter)
+	assert.False(t, roots[0].Filter.Allows(logwatch.LogLabels{Namespace: "kube-system"}))
+	assert.True(t, roots[0].Filter.Allows(logwatch.LogLabels{Namespace: "tenant"}))
+	assert.True(t, roots[1].Filter.Allows(logwatch.LogLabels{Namespace: "kube-system", Container: "billing"}))
+	assert.False(t, roots[1].Filter.Allows(logwatch.LogLabels{Container: "other"}))
+
+	_, err = Load(writeConfig(t, `filter: {pods: {include: ['[']}}`))
+	assert.Error(t, err)
+}
+
+func TestLoadSeriesTTL(t *testing.T) {
+	c, err := Load(writeConfig(t, `seriesTTL: 24h`))
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, c.SeriesTTL.Duration)
+}
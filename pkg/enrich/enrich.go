@@ -0,0 +1,179 @@
+// Package enrich adds Pod metadata from the Kubernetes API to log file metrics.
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+)
+
+// resyncPeriod of the Pod informer.
+const resyncPeriod = 10 * time.Minute
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Config selects the Pod metadata added as metric labels.
+// Each added label multiplies the number of series, only select what is needed.
+type Config struct {
+	// PodLabels is the allowlist of Pod labels to add, as metric labels named "label_<name>"
+	// with invalid characters replaced by "_", e.g. "app.kubernetes.io/name" is "label_app_kubernetes_io_name".
+	PodLabels []string `json:"podLabels,omitempty"`
+	// Owner adds the "owner_kind" and "owner_name" labels for the workload controlling the Pod:
+	// Deployment, StatefulSet, DaemonSet, Job, or the kind of any other controller.
+	Owner bool `json:"owner,omitempty"`
+	// Node adds the "nodename" label.
+	Node bool `json:"node,omitempty"`
+}
+
+// LabelNames returns the names of the metric labels added by the configuration.
+func (c *Config) LabelNames() []string {
+	var names []string
+	for _, l := range c.PodLabels {
+		names = append(names, "label_"+invalidLabelChars.ReplaceAllString(l, "_"))
+	}
+	if c.Owner {
+		names = append(names, "owner_kind", "owner_name")
+	}
+	if c.Node {
+		names = append(names, "nodename")
+	}
+	return names
+}
+
+// Validate the configuration.
+func (c *Config) Validate() error {
+	names := map[string]string{}
+	for _, l := range c.PodLabels {
+		if l == "" {
+			return fmt.Errorf("empty pod label name")
+		}
+		name := "label_" + invalidLabelChars.ReplaceAllString(l, "_")
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("pod labels %q and %q have the same metric label %q", other, l, name)
+		}
+		names[name] = l
+	}
+	return nil
+}
+
+// Enricher is a logwatch.Enricher that looks up Pods in an informer cache of the Pods on a node.
+type Enricher struct {
+	config  Config
+	names   []string
+	factory informers.SharedInformerFactory
+	pods    listersv1.PodLister
+	stop    chan struct{}
+}
+
+var (
+	_ logwatch.Enricher         = &Enricher{}
+	_ logwatch.WorkloadResolver = &Enricher{}
+)
+
+// New creates an Enricher for the Pods on nodeName, all Pods if nodeName is empty.
+// Start must be called before it is used.
+func New(client kubernetes.Interface, nodeName string, c Config) *Enricher {
+	var opts []informers.SharedInformerOption
+	if nodeName != "" {
+		opts = append(opts, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+		}))
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, opts...)
+	return &Enricher{
+		config:  c,
+		names:   c.LabelNames(),
+		factory: factory,
+		pods:    factory.Core().V1().Pods().Lister(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start the informer and wait until the Pod cache is filled, or ctx is done.
+func (e *Enricher) Start(ctx context.Context) error {
+	e.factory.Start(e.stop)
+	for typ, ok := range e.factory.WaitForCacheSync(ctx.Done()) {
+		if !ok {
+			return fmt.Errorf("error syncing %v informer cache: %w", typ, ctx.Err())
+		}
+	}
+	log.V(3).Info("pod informer cache synced")
+	return nil
+}
+
+// Close stops the informer.
+func (e *Enricher) Close() {
+	close(e.stop)
+	e.factory.Shutdown()
+}
+
+// LabelNames implements logwatch.Enricher.
+func (e *Enricher) LabelNames() []string { return e.names }
+
+// pod returns the Pod of a container, nil if it is not in the cache.
+func (e *Enricher) pod(l logwatch.LogLabels) *corev1.Pod {
+	pod, err := e.pods.Pods(l.Namespace).Get(l.Name)
+	if err != nil || (l.UUID != "" && string(pod.UID) != l.UUID) {
+		return nil
+	}
+	return pod
+}
+
+// Workload implements logwatch.WorkloadResolver, the workload is empty if the Pod is not in the cache.
+func (e *Enricher) Workload(l logwatch.LogLabels) (kind, name string) {
+	if pod := e.pod(l); pod != nil {
+		return owner(pod)
+	}
+	return "", ""
+}
+
+// LabelValues implements logwatch.Enricher. Values are empty if the Pod is not in the cache.
+func (e *Enricher) LabelValues(l logwatch.LogLabels) []string {
+	values := make([]string, len(e.names))
+	pod := e.pod(l)
+	if pod == nil {
+		return values
+	}
+	i := 0
+	for _, name := range e.config.PodLabels {
+		values[i] = pod.Labels[name]
+		i++
+	}
+	if e.config.Owner {
+		values[i], values[i+1] = owner(pod)
+		i += 2
+	}
+	if e.config.Node {
+		values[i] = pod.Spec.NodeName
+	}
+	return values
+}
+
+// owner returns the kind and name of the workload controlling pod, empty if it has no controller.
+// Pods of a ReplicaSet created by a Deployment are attributed to the Deployment, using the
+// pod-template-hash suffix the Deployment controller adds to ReplicaSet names.
+func owner(pod *corev1.Pod) (kind, name string) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return "", ""
+	}
+	if ref.Kind == "ReplicaSet" {
+		if hash := pod.Labels["pod-template-hash"]; hash != "" {
+			if deployment, ok := strings.CutSuffix(ref.Name, "-"+hash); ok {
+				return "Deployment", deployment
+			}
+		}
+	}
+	return ref.Kind, ref.Name
+}
@@ -0,0 +1,71 @@
+package enrich
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/log-file-metric-exporter/pkg/logwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pod(name, uid string, labels map[string]string, owner *metav1.OwnerReference) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, UID: types.UID("uid-" + uid), Labels: labels},
+		Spec:       corev1.PodSpec{NodeName: "node1"},
+	}
+	if owner != nil {
+		controller := true
+		owner.Controller = &controller
+		p.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return p
+}
+
+func TestEnricher(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		pod("web-5d8f9c-abcde", "1", map[string]string{"app.kubernetes.io/name": "web", "pod-template-hash": "5d8f9c"},
+			&metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-5d8f9c"}),
+		pod("db-0", "2", nil, &metav1.OwnerReference{Kind: "StatefulSet", Name: "db"}),
+		pod("backup-28123-xyz", "3", nil, &metav1.OwnerReference{Kind: "Job", Name: "backup-28123"}),
+		pod("bare", "4", nil, nil),
+	)
+	c := Config{PodLabels: []string{"app.kubernetes.io/name"}, Owner: true, Node: true}
+	require.NoError(t, c.Validate())
+	e := New(client, "node1", c)
+	defer e.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, e.Start(ctx))
+
+	assert.Equal(t, []string{"label_app_kubernetes_io_name", "owner_kind", "owner_name", "nodename"}, e.LabelNames())
+	for _, x := range []struct {
+		l    logwatch.LogLabels
+		want []string
+	}{
+		{logwatch.LogLabels{Namespace: "ns", Name: "web-5d8f9c-abcde", UUID: "uid-1"}, []string{"web", "Deployment", "web", "node1"}},
+		{logwatch.LogLabels{Namespace: "ns", Name: "db-0", UUID: "uid-2"}, []string{"", "StatefulSet", "db", "node1"}},
+		{logwatch.LogLabels{Namespace: "ns", Name: "backup-28123-xyz", UUID: "uid-3"}, []string{"", "Job", "backup-28123", "node1"}},
+		{logwatch.LogLabels{Namespace: "ns", Name: "bare", UUID: "uid-4"}, []string{"", "", "", "node1"}},
+		// Unknown pod, or a different pod with the same name.
+		{logwatch.LogLabels{Namespace: "ns", Name: "missing", UUID: "uid-5"}, []string{"", "", "", ""}},
+		{logwatch.LogLabels{Namespace: "ns", Name: "db-0", UUID: "uid-6"}, []string{"", "", "", ""}},
+	} {
+		t.Run(x.l.Name, func(t *testing.T) {
+			assert.Equal(t, x.want, e.LabelValues(x.l))
+			kind, name := e.Workload(x.l)
+			assert.Equal(t, x.want[1:3], []string{kind, name})
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&Config{PodLabels: []string{"app", "tier"}}).Validate())
+	assert.Error(t, (&Config{PodLabels: []string{""}}).Validate())
+	assert.Error(t, (&Config{PodLabels: []string{"a.b", "a/b"}}).Validate())
+}
@@ -0,0 +1,108 @@
+// Package fakenotify provides an in-memory file system watcher for tests.
+//
+// Events are only delivered when sent by the test, so tests control exactly which events
+// a watcher sees and when, independently of the timing of real file system notifications.
+package fakenotify
+
+import (
+	"io"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type Event = fsnotify.Event
+
+// item is a queued event or error.
+type item struct {
+	event Event
+	err   error
+}
+
+// Watcher has the same methods as symnotify.Watcher, and returns the events sent to it.
+type Watcher struct {
+	mutex   sync.Mutex
+	ready   *sync.Cond
+	queue   []item
+	watched map[string]bool
+	closed  bool
+}
+
+func NewWatcher() *Watcher {
+	w := &Watcher{watched: map[string]bool{}}
+	w.ready = sync.NewCond(&w.mutex)
+	return w
+}
+
+// Send queues events to be returned by Event.
+func (w *Watcher) Send(events ...Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, e := range events {
+		w.queue = append(w.queue, item{event: e})
+	}
+	w.ready.Broadcast()
+}
+
+// SendError queues an error to be returned by Event, e.g. fsnotify.ErrEventOverflow.
+func (w *Watcher) SendError(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.queue = append(w.queue, item{err: err})
+	w.ready.Broadcast()
+}
+
+// Pending returns the number of queued events and errors.
+func (w *Watcher) Pending() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.queue)
+}
+
+// Event returns the next queued event or error, blocking until there is one.
+// Returns io.EOF when the watcher is closed.
+func (w *Watcher) Event() (Event, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for len(w.queue) == 0 && !w.closed {
+		w.ready.Wait()
+	}
+	if w.closed {
+		return Event{}, io.EOF
+	}
+	it := w.queue[0]
+	w.queue = w.queue[1:]
+	return it.event, it.err
+}
+
+// Add records name as watched.
+func (w *Watcher) Add(name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.watched[name] = true
+	return nil
+}
+
+// Remove records name as no longer watched.
+func (w *Watcher) Remove(name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.watched, name)
+	return nil
+}
+
+// Watched returns true if name was added and not removed.
+func (w *Watcher) Watched(name string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.watched[name]
+}
+
+// Close the watcher, Event returns io.EOF.
+func (w *Watcher) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	w.ready.Broadcast()
+	return nil
+}
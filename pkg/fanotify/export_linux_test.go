@@ -0,0 +1,8 @@
+package fanotify
+
+// CachedDirs returns the number of directories cached under and outside the watched paths.
+func (w *Watcher) CachedDirs() (watched, ignored int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.dirs), len(w.ignored)
+}
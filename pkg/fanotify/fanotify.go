@@ -0,0 +1,18 @@
+// Package fanotify provides a file system watcher that watches whole file systems with a single fanotify mark,
+// instead of an inotify watch per directory which can exceed fs.inotify.max_user_watches on nodes with many Pods.
+//
+// It has the same methods and events as symnotify.Watcher, so it can be used in its place, with two differences:
+// it requires Linux 5.9 or later and the CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH capabilities,
+// and changes to symlink targets are reported under the target path, not the symlink path.
+package fanotify
+
+import (
+	"errors"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type Event = fsnotify.Event
+
+// ErrNotSupported is returned by NewWatcher if fanotify is not available on this platform.
+var ErrNotSupported = errors.New("fanotify is not supported")
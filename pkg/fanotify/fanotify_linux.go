@@ -0,0 +1,368 @@
+package fanotify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sys/unix"
+)
+
+// markMask are the events reported for marked file systems.
+const markMask = unix.FAN_MODIFY | unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO | unix.FAN_ONDIR
+
+// maxHandleSize is the maximum size of a file handle, MAX_HANDLE_SZ.
+const maxHandleSize = 128
+
+// maxIgnoredDirs bounds the number of directories outside the watched paths that are remembered,
+// they are forgotten when there are more.
+const maxIgnoredDirs = 4096
+
+// fsid identifies a file system in events.
+type fsid [2]int32
+
+// dirKey identifies a directory by file system and file handle.
+type dirKey struct {
+	fsid       fsid
+	handleType int32
+	size       int
+	handle     [maxHandleSize]byte
+}
+
+// Watcher reports changes to files under the watched paths, using a fanotify mark for each file system.
+type Watcher struct {
+	file   *os.File
+	events chan Event
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+
+	mutex sync.Mutex
+	roots map[string]bool
+	// mounts has an open directory on each marked file system, used to resolve file handles.
+	mounts map[fsid]*os.File
+	// dirs has the paths of directories under the watched paths.
+	dirs map[dirKey]string
+	// ignored has directories outside the watched paths, so events in them are dropped without resolving them again.
+	// A mark covers the whole file system, most events are in such directories.
+	ignored map[dirKey]bool
+}
+
+// NewWatcher returns a watcher, or an error if fanotify is not available,
+// e.g. if the kernel is too old or the process lacks the CAP_SYS_ADMIN capability.
+func NewWatcher() (*Watcher, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_REPORT_DFID_NAME|unix.FAN_NONBLOCK|unix.FAN_CLOEXEC,
+		unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify_init: %w", err)
+	}
+	w := &Watcher{
+		file:    os.NewFile(uintptr(fd), "fanotify"), // Non-blocking, so reads are interrupted by Close.
+		events:  make(chan Event, 1024),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+		roots:   map[string]bool{},
+		mounts:  map[fsid]*os.File{},
+		dirs:    map[dirKey]string{},
+		ignored: map[dirKey]bool{},
+	}
+	go w.run()
+	return w, nil
+}
+
+// Event returns the next event or an error, io.EOF if the watcher is closed.
+func (w *Watcher) Event() (Event, error) {
+	select {
+	case e := <-w.events:
+		return e, nil
+	case err := <-w.errors:
+		return Event{}, err
+	case <-w.done:
+		return Event{}, io.EOF
+	}
+}
+
+// Add a directory tree to be watched. The whole file system containing name is marked,
+// events outside the watched paths are ignored.
+func (w *Watcher) Add(name string) error {
+	log.V(3).Info("start watching file system", "path", name)
+	name = filepath.Clean(name)
+	var st unix.Statfs_t
+	if err := unix.Statfs(name, &st); err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.roots[name] {
+		return nil
+	}
+	id := fsid(st.Fsid.Val)
+	if w.mounts[id] == nil {
+		if err := unix.FanotifyMark(int(w.file.Fd()), unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, markMask, unix.AT_FDCWD, name); err != nil {
+			return fmt.Errorf("fanotify_mark %v: %w", name, err)
+		}
+		mount, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		w.mounts[id] = mount
+	}
+	w.roots[name] = true
+	clear(w.ignored)
+	return nil
+}
+
+// Watches returns the number of fanotify marks, one per watched file system.
+func (w *Watcher) Watches() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.mounts)
+}
+
+// Remove name from the watched paths, if it was added. The file system mark is kept.
+func (w *Watcher) Remove(name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.roots, filepath.Clean(name))
+	for key, dir := range w.dirs {
+		if !w.under(dir) {
+			delete(w.dirs, key)
+		}
+	}
+	return nil
+}
+
+// Close stops watching, Event returns io.EOF.
+func (w *Watcher) Close() (err error) {
+	w.once.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		for _, m := range w.mounts {
+			_ = m.Close()
+		}
+	})
+	return err
+}
+
+func (w *Watcher) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.send(Event{}, fmt.Errorf("reading fanotify events: %w", err))
+			}
+			return
+		}
+		if err := w.parse(buf[:n]); err != nil {
+			w.send(Event{}, err)
+		}
+	}
+}
+
+// send an event or error, returns false if the watcher is closed.
+func (w *Watcher) send(e Event, err error) bool {
+	if err != nil {
+		select {
+		case w.errors <- err:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	select {
+	case w.events <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// parse the events in buf and send them.
+//
+// Each event is a struct fanotify_event_metadata followed by info records.
+// With FAN_REPORT_DFID_NAME there is a record with the file system id, the file handle of the parent directory,
+// and the name of the file in the directory.
+func (w *Watcher) parse(buf []byte) error {
+	order := binary.NativeEndian
+	for len(buf) >= unix.FAN_EVENT_METADATA_LEN {
+		eventLen := order.Uint32(buf[0:4])
+		if eventLen < unix.FAN_EVENT_METADATA_LEN || int(eventLen) > len(buf) {
+			return fmt.Errorf("invalid fanotify event length %v", eventLen)
+		}
+		if vers := buf[4]; vers != unix.FANOTIFY_METADATA_VERSION {
+			return fmt.Errorf("unsupported fanotify metadata version %v", vers)
+		}
+		metadataLen := order.Uint16(buf[6:8])
+		mask := order.Uint64(buf[8:16])
+		if fd := int32(order.Uint32(buf[16:20])); fd >= 0 {
+			_ = unix.Close(int(fd)) // Not expected with FAN_REPORT_DFID_NAME.
+		}
+		info := buf[metadataLen:eventLen]
+		buf = buf[eventLen:]
+		if mask&unix.FAN_Q_OVERFLOW != 0 {
+			if !w.send(Event{}, fsnotify.ErrEventOverflow) {
+				return nil
+			}
+			continue
+		}
+		if mask&unix.FAN_ONDIR != 0 && mask&unix.FAN_MOVED_FROM != 0 {
+			// The directory may be moved under a watched path.
+			w.mutex.Lock()
+			clear(w.ignored)
+			w.mutex.Unlock()
+		}
+		path, ok := w.resolve(info)
+		if !ok {
+			continue
+		}
+		for _, e := range w.translate(path, mask) {
+			if !w.send(e, nil) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the path of the file from the info records of an event,
+// false if it cannot be resolved or is not under a watched path.
+func (w *Watcher) resolve(info []byte) (string, bool) {
+	order := binary.NativeEndian
+	for len(info) >= 4 {
+		typ, recordLen := info[0], int(order.Uint16(info[2:4]))
+		if recordLen < 4 || recordLen > len(info) {
+			return "", false
+		}
+		record := info[:recordLen]
+		info = info[recordLen:]
+		if typ != unix.FAN_EVENT_INFO_TYPE_DFID_NAME || len(record) < 20 {
+			continue
+		}
+		id := fsid{int32(order.Uint32(record[4:8])), int32(order.Uint32(record[8:12]))}
+		handleBytes := int(order.Uint32(record[12:16]))
+		handleType := int32(order.Uint32(record[16:20]))
+		if 20+handleBytes > len(record) || handleBytes > maxHandleSize {
+			return "", false
+		}
+		key := dirKey{fsid: id, handleType: handleType, size: handleBytes}
+		copy(key.handle[:], record[20:20+handleBytes])
+		name := record[20+handleBytes:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		dir, ok := w.dir(key)
+		if !ok {
+			return "", false
+		}
+		path := filepath.Join(dir, string(name))
+		return path, w.watched(path)
+	}
+	return "", false
+}
+
+// dir returns the path of a directory from its file handle, false if it can't be resolved
+// or events in it can't be under a watched path.
+func (w *Watcher) dir(key dirKey) (string, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if dir, ok := w.dirs[key]; ok {
+		return dir, true
+	}
+	if w.ignored[key] {
+		return "", false
+	}
+	mount := w.mounts[key.fsid]
+	if mount == nil {
+		return "", false
+	}
+	fd, err := unix.OpenByHandleAt(int(mount.Fd()), unix.NewFileHandle(key.handleType, key.handle[:key.size]), unix.O_PATH)
+	if err != nil {
+		return "", false // Directory removed.
+	}
+	defer unix.Close(fd)
+	dir, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case w.under(dir):
+		w.dirs[key] = dir
+	case !w.above(dir):
+		if len(w.ignored) >= maxIgnoredDirs {
+			clear(w.ignored)
+		}
+		w.ignored[key] = true
+		return "", false
+	}
+	// Directories above the watched paths are not cached, only events for the watched paths themselves are kept.
+	return dir, true
+}
+
+// translate returns the fsnotify events for an event mask.
+// Cached directory paths are forgotten when a directory is removed or renamed.
+func (w *Watcher) translate(path string, mask uint64) []Event {
+	var events []Event
+	if mask&(unix.FAN_CREATE|unix.FAN_MOVED_TO) != 0 {
+		events = append(events, Event{Name: path, Op: fsnotify.Create})
+	}
+	if mask&unix.FAN_MODIFY != 0 {
+		events = append(events, Event{Name: path, Op: fsnotify.Write})
+	}
+	if mask&unix.FAN_MOVED_FROM != 0 {
+		events = append(events, Event{Name: path, Op: fsnotify.Rename})
+	}
+	if mask&unix.FAN_DELETE != 0 {
+		events = append(events, Event{Name: path, Op: fsnotify.Remove})
+	}
+	if mask&unix.FAN_ONDIR != 0 && mask&(unix.FAN_DELETE|unix.FAN_MOVED_FROM) != 0 {
+		w.mutex.Lock()
+		for key, dir := range w.dirs {
+			if dir == path || strings.HasPrefix(dir, path+"/") {
+				delete(w.dirs, key)
+			}
+		}
+		w.mutex.Unlock()
+	}
+	return events
+}
+
+// watched returns true if path is under a watched path.
+func (w *Watcher) watched(path string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.under(path)
+}
+
+// above returns true if a watched path is under dir. Must be called with the mutex locked.
+func (w *Watcher) above(dir string) bool {
+	for root := range w.roots {
+		if strings.HasPrefix(root, dir) && (dir == "/" || strings.HasPrefix(root[len(dir):], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// under returns true if path is a watched path or under one. Must be called with the mutex locked.
+func (w *Watcher) under(path string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if w.roots[dir] {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package fanotify
+
+// Watcher is not supported on this platform.
+type Watcher struct{}
+
+// NewWatcher returns ErrNotSupported.
+func NewWatcher() (*Watcher, error) { return nil, ErrNotSupported }
+
+func (w *Watcher) Event() (Event, error)    { return Event{}, ErrNotSupported }
+func (w *Watcher) Add(name string) error    { return ErrNotSupported }
+func (w *Watcher) Remove(name string) error { return ErrNotSupported }
+func (w *Watcher) Close() error             { return nil }
+func (w *Watcher) Watches() int             { return 0 }
@@ -0,0 +1,99 @@
+package fanotify_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/log-file-metric-exporter/pkg/fanotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWatcher returns a watcher for a temporary directory, the test is skipped if fanotify is not available.
+func newWatcher(t *testing.T) (*fanotify.Watcher, string) {
+	t.Helper()
+	w, err := fanotify.NewWatcher()
+	if err != nil {
+		t.Skipf("fanotify not available: %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	dir := t.TempDir()
+	if err := w.Add(dir); err != nil {
+		t.Skipf("fanotify not available: %v", err)
+	}
+	return w, dir
+}
+
+// waitFor reads events until want has been seen, ignoring others.
+func waitFor(t *testing.T, w *fanotify.Watcher, want fanotify.Event) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		got := make(chan fanotify.Event, 1)
+		go func() {
+			e, _ := w.Event()
+			got <- e
+		}()
+		select {
+		case e := <-got:
+			if e == want {
+				return
+			}
+		case <-deadline:
+			require.Fail(t, "missing event", "%v", want)
+		}
+	}
+}
+
+func TestFanotify(t *testing.T) {
+	w, dir := newWatcher(t)
+	sub := filepath.Join(dir, "pod", "container")
+	require.NoError(t, os.MkdirAll(sub, 0700))
+	path := filepath.Join(sub, "0.log")
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0600))
+	waitFor(t, w, fanotify.Event{Name: path, Op: fsnotify.Create})
+	waitFor(t, w, fanotify.Event{Name: path, Op: fsnotify.Write})
+
+	rotated := path + ".20240101-000000"
+	require.NoError(t, os.Rename(path, rotated))
+	waitFor(t, w, fanotify.Event{Name: path, Op: fsnotify.Rename})
+	waitFor(t, w, fanotify.Event{Name: rotated, Op: fsnotify.Create})
+	require.NoError(t, os.Remove(rotated))
+	waitFor(t, w, fanotify.Event{Name: rotated, Op: fsnotify.Remove})
+
+	// Files outside the watched paths are ignored.
+	other := filepath.Join(t.TempDir(), "other.log")
+	require.NoError(t, os.WriteFile(other, []byte("hello\n"), 0600))
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0600))
+	e, err := w.Event()
+	require.NoError(t, err)
+	assert.Equal(t, path, e.Name)
+}
+
+func TestFanotifyIgnoredDirs(t *testing.T) {
+	w, dir := newWatcher(t)
+	path := filepath.Join(dir, "0.log")
+	other := t.TempDir()
+	for i := 0; i < 10; i++ {
+		sub := filepath.Join(other, strconv.Itoa(i))
+		require.NoError(t, os.Mkdir(sub, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(sub, "0.log"), []byte("hello\n"), 0600))
+	}
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0600))
+	waitFor(t, w, fanotify.Event{Name: path, Op: fsnotify.Write})
+
+	// Only directories under the watched paths are cached.
+	watched, ignored := w.CachedDirs()
+	assert.Equal(t, 1, watched)
+	assert.GreaterOrEqual(t, ignored, 10)
+
+	// A directory moved under a watched path is no longer ignored.
+	moved := filepath.Join(dir, "moved")
+	require.NoError(t, os.Rename(filepath.Join(other, "0"), moved))
+	require.NoError(t, os.WriteFile(filepath.Join(moved, "0.log"), []byte("hello\n"), 0600))
+	waitFor(t, w, fanotify.Event{Name: filepath.Join(moved, "0.log"), Op: fsnotify.Write})
+}
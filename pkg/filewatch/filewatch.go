@@ -0,0 +1,88 @@
+// Package filewatch calls a function when the content of files changes.
+//
+// The directories containing the files are watched rather than the files themselves, so changes are seen
+// when a file is replaced, including Kubernetes ConfigMap and Secret volumes that are updated by swapping symlinks.
+package filewatch
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/log-file-metric-exporter/pkg/symnotify"
+)
+
+// Watcher calls a function when the content of any of its files changes.
+type Watcher struct {
+	paths   []string
+	changed func()
+	watcher *symnotify.Watcher
+	mutex   sync.Mutex
+	sums    map[string][sha256.Size]byte
+}
+
+// New starts watching paths, changed is called from a separate goroutine after any of the files change.
+func New(paths []string, changed func()) (*Watcher, error) {
+	watcher, err := symnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{paths: paths, changed: changed, watcher: watcher, sums: map[string][sha256.Size]byte{}}
+	w.modified() // Initial checksums
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if !dirs[dir] {
+			dirs[dir] = true
+			if err := watcher.Add(dir); err != nil {
+				_ = watcher.Close()
+				return nil, err
+			}
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error { return w.watcher.Close() }
+
+func (w *Watcher) run() {
+	for {
+		e, err := w.watcher.Event()
+		switch {
+		case err == io.EOF:
+			return
+		case err != nil:
+			log.Error(err, "error watching files", "paths", w.paths)
+		default:
+			log.V(3).Info("filewatch event", "path", e.Name, "operation", e.Op.String())
+			if w.modified() {
+				w.changed()
+			}
+		}
+	}
+}
+
+// modified updates the file checksums, returns true if any of them changed.
+// Files that can't be read keep their last checksum, they may be in the middle of an update.
+func (w *Watcher) modified() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	modified := false
+	for _, path := range w.paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if old, ok := w.sums[path]; !ok || old != sum {
+			w.sums[path] = sum
+			modified = modified || ok
+		}
+	}
+	return modified
+}
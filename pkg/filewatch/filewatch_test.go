@@ -0,0 +1,53 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0600))
+	var changes atomic.Int32
+	w, err := New([]string{path}, func() { changes.Add(1) })
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	// Unrelated files and replacements with the same content are ignored.
+	// Rename the replacement into place, WriteFile truncates first so the file could be seen empty.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other"), []byte("a"), 0600))
+	require.NoError(t, os.Rename(filepath.Join(dir, "other"), path))
+	time.Sleep(time.Second / 10)
+	assert.Equal(t, int32(0), changes.Load())
+
+	require.NoError(t, os.WriteFile(path, []byte("b"), 0600))
+	assert.Eventually(t, func() bool { return changes.Load() == 1 }, time.Second, time.Second/10)
+}
+
+func TestWatcherSymlinkSwap(t *testing.T) {
+	// Simulate a Kubernetes ConfigMap volume: config.yaml -> ..data/config.yaml, ..data -> ..v1
+	dir := t.TempDir()
+	for _, v := range []string{"..v1", "..v2"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, v), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, v, "config.yaml"), []byte(v), 0600))
+	}
+	require.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), path))
+
+	var changes atomic.Int32
+	w, err := New([]string{path}, func() { changes.Add(1) })
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = w.Close() })
+
+	require.NoError(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.Eventually(t, func() bool { return changes.Load() == 1 }, time.Second, time.Second/10)
+}
@@ -0,0 +1,69 @@
+// Package health serves liveness and readiness checks for probes, e.g. on /healthz and /readyz.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Check returns an error if the checked component is not healthy or not ready.
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checks are named liveness and readiness checks. Checks can be added while they are served.
+type Checks struct {
+	mutex sync.RWMutex
+	live  []namedCheck
+	ready []namedCheck
+}
+
+// AddLiveness adds a check that fails if the process must be restarted.
+func (c *Checks) AddLiveness(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.live = append(c.live, namedCheck{name: name, check: check})
+}
+
+// AddReadiness adds a check that fails until the process is ready to serve.
+func (c *Checks) AddReadiness(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ready = append(c.ready, namedCheck{name: name, check: check})
+}
+
+// LivenessHandler serves the liveness checks.
+func (c *Checks) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { c.serve(w, &c.live) })
+}
+
+// ReadinessHandler serves the readiness checks.
+func (c *Checks) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { c.serve(w, &c.ready) })
+}
+
+// serve runs checks and responds with status 200 if all pass, 503 otherwise.
+// The body has a line per check, "[+]name ok" or "[-]name failed: reason", like the Kubernetes API server.
+func (c *Checks) serve(w http.ResponseWriter, checks *[]namedCheck) {
+	c.mutex.RLock()
+	run := append([]namedCheck(nil), *checks...)
+	c.mutex.RUnlock()
+	var body strings.Builder
+	status := http.StatusOK
+	for _, nc := range run {
+		if err := nc.check(); err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&body, "[-]%v failed: %v\n", nc.name, err)
+		} else {
+			fmt.Fprintf(&body, "[+]%v ok\n", nc.name)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body.String()))
+}
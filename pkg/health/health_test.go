@@ -0,0 +1,35 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func get(h http.Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestChecks(t *testing.T) {
+	c := &Checks{}
+	assert.Equal(t, http.StatusOK, get(c.LivenessHandler()).Code)
+	assert.Equal(t, http.StatusOK, get(c.ReadinessHandler()).Code)
+
+	ready := errors.New("starting")
+	c.AddLiveness("watch", func() error { return nil })
+	c.AddReadiness("watch", func() error { return ready })
+	w := get(c.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "[-]watch failed: starting\n", w.Body.String())
+	w = get(c.LivenessHandler())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[+]watch ok\n", w.Body.String())
+
+	ready = nil
+	assert.Equal(t, http.StatusOK, get(c.ReadinessHandler()).Code)
+}
@@ -0,0 +1,104 @@
+package logwatch
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WorkloadResolver is an optional interface of an Enricher that knows the workload controlling the Pod of a container.
+type WorkloadResolver interface {
+	// Workload returns the kind and name of the workload, empty if not known.
+	Workload(l LogLabels) (kind, name string)
+}
+
+// aggregate is a counter summed over containers, by label values other than the container labels.
+// A series is kept while it has containers, and for retiredRetention after the last one is gone,
+// so its value does not drop when the containers of a workload are replaced.
+//
+// It is not safe for concurrent use, callers must synchronize.
+type aggregate struct {
+	vec     *prometheus.CounterVec
+	members map[LogLabels]string // Series key of each container.
+	count   map[string]int       // Number of containers by series key.
+	retired map[string]time.Time // Series with no containers left, by time of the last removal.
+}
+
+func newAggregate(opts prometheus.CounterOpts, labelNames []string) *aggregate {
+	return &aggregate{
+		vec:     prometheus.NewCounterVec(opts, labelNames),
+		members: make(map[LogLabels]string),
+		count:   make(map[string]int),
+		retired: make(map[string]time.Time),
+	}
+}
+
+// aggregateKey joins label values into a series key.
+func aggregateKey(values []string) string { return strings.Join(values, "\x00") }
+
+// add v for container l to the series with the given label values.
+// A container moves to another series if its values change.
+func (a *aggregate) add(l LogLabels, values []string, v float64) {
+	key := aggregateKey(values)
+	if old, ok := a.members[l]; !ok || old != key {
+		if ok {
+			a.leave(old)
+		}
+		a.members[l] = key
+		a.count[key]++
+		delete(a.retired, key)
+	}
+	a.vec.WithLabelValues(values...).Add(v)
+}
+
+// remove a container that has no files left.
+func (a *aggregate) remove(l LogLabels) {
+	if key, ok := a.members[l]; ok {
+		delete(a.members, l)
+		a.leave(key)
+	}
+}
+
+func (a *aggregate) leave(key string) {
+	a.count[key]--
+	if a.count[key] > 0 {
+		return
+	}
+	delete(a.count, key)
+	a.retired[key] = time.Now()
+}
+
+// expire deletes series that have had no containers for retiredRetention.
+func (a *aggregate) expire(now time.Time) {
+	for key, t := range a.retired {
+		if now.Sub(t) > retiredRetention {
+			delete(a.retired, key)
+			a.vec.DeleteLabelValues(strings.Split(key, "\x00")...)
+		}
+	}
+}
+
+// aggregates returns the aggregated metrics of the watcher.
+func (w *Watcher) aggregates() []*aggregate {
+	var as []*aggregate
+	for _, a := range []*aggregate{w.namespaceBytes, w.workloadBytes} {
+		if a != nil {
+			as = append(as, a)
+		}
+	}
+	return as
+}
+
+// aggregate adds bytes logged by container l to the aggregated metrics. l are the container labels,
+// not the overflow labels, so aggregated series are exact when containers overflow.
+// Must be called with the mutex locked.
+func (w *Watcher) aggregate(l LogLabels, bytes float64) {
+	if w.namespaceBytes != nil {
+		w.namespaceBytes.add(l, []string{l.Namespace}, bytes)
+	}
+	if w.workloadBytes != nil {
+		kind, name := w.enricher.(WorkloadResolver).Workload(l)
+		w.workloadBytes.add(l, []string{l.Namespace, kind, name}, bytes)
+	}
+}
@@ -0,0 +1,66 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct{ fakeEnricher }
+
+func (fakeResolver) Workload(l LogLabels) (kind, name string) { return "StatefulSet", "prometheus-k8s" }
+
+func TestWatcherAggregate(t *testing.T) {
+	w, path, l := setupWithOptions(t,
+		func(path string) { writeToFile(t, path) },
+		func(string) Options {
+			return Options{MetricPrefix: "aggregated_", Aggregate: true, MaxSeries: 1, Enricher: fakeResolver{fakeEnricher{}}}
+		})
+	namespace := func() float64 { return testutil.ToFloat64(w.namespaceBytes.vec.WithLabelValues(l.Namespace)) }
+	workload := func() float64 {
+		return testutil.ToFloat64(w.workloadBytes.vec.WithLabelValues(l.Namespace, "StatefulSet", "prometheus-k8s"))
+	}
+	assert.Equal(t, float64(len(data)), namespace())
+	assert.Equal(t, float64(len(data)), workload())
+
+	// Another container of the same Pod is added to the aggregates, though it is in the overflow series.
+	other := filepath.Join(filepath.Dir(filepath.Dir(path)), "other", "0.log")
+	require.NoError(t, os.MkdirAll(filepath.Dir(other), 0700))
+	time.Sleep(time.Second / 10) // Let the watcher start watching the new directory.
+	writeToFile(t, other)
+	assert.Eventually(t, func() bool { return namespace() == float64(2*len(data)) },
+		time.Second, time.Second/10, "%v != %v", namespace(), 2*len(data))
+	assert.Equal(t, float64(2*len(data)), workload())
+
+	// The aggregates are kept when a container is gone.
+	require.NoError(t, os.Remove(other))
+	assert.Eventually(t, func() bool {
+		n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "aggregated_logged_bytes_total")
+		require.NoError(t, err)
+		return n == 1
+	}, time.Second, time.Second/10)
+	assert.Equal(t, float64(2*len(data)), namespace())
+	assert.Equal(t, float64(2*len(data)), workload())
+}
+
+func TestAggregateExpire(t *testing.T) {
+	a := newAggregate(prometheus.CounterOpts{Name: "test"}, []string{"namespace"})
+	l1, l2 := LogLabels{Namespace: "ns", Name: "a"}, LogLabels{Namespace: "ns", Name: "b"}
+	a.add(l1, []string{"ns"}, 1)
+	a.add(l2, []string{"ns"}, 2)
+	a.remove(l1)
+	a.expire(time.Now().Add(2 * retiredRetention))
+	assert.Equal(t, float64(3), testutil.ToFloat64(a.vec.WithLabelValues("ns")))
+
+	a.remove(l2)
+	a.expire(time.Now())
+	assert.Equal(t, 1, testutil.CollectAndCount(a.vec))
+	a.expire(time.Now().Add(2 * retiredRetention))
+	assert.Equal(t, 0, testutil.CollectAndCount(a.vec))
+}
@@ -0,0 +1,142 @@
+package logwatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkpointVersion is incremented when the checkpoint format changes incompatibly.
+const checkpointVersion = 1
+
+// Checkpoint is the saved state of watched log files.
+// It is used to resume counting where the previous exporter process stopped,
+// instead of counting existing files again from the start.
+type Checkpoint struct {
+	Version int              `json:"version"`
+	Files   []FileCheckpoint `json:"files"`
+}
+
+// FileCheckpoint is the saved state of a single log file.
+type FileCheckpoint struct {
+	Path string `json:"path"`
+	FileID
+	// Offset up to which the file has been counted.
+	Offset int64 `json:"offset"`
+	// Head is the start of an unterminated line at Offset.
+	Head []byte `json:"head,omitempty"`
+}
+
+// FileID identifies a file independently of its path.
+type FileID struct {
+	Dev   uint64 `json:"dev"`
+	Inode uint64 `json:"inode"`
+}
+
+// fileIDOf returns the FileID for info, the zero FileID if it is not available.
+func fileIDOf(info os.FileInfo) FileID {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return FileID{Dev: uint64(st.Dev), Inode: uint64(st.Ino)}
+	}
+	return FileID{}
+}
+
+// LoadCheckpoint reads a checkpoint file.
+// Returns an empty checkpoint if the file does not exist.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{Version: checkpointVersion}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %v: %w", path, err)
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %v: %v", c.Version, path)
+	}
+	return c, nil
+}
+
+// Save writes the checkpoint to path atomically: a temporary file is written and synced,
+// then renamed over path, so a crash never leaves a partially written checkpoint.
+func (c *Checkpoint) Save(path string) (err error) {
+	c.Version = checkpointVersion
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Checkpoint returns the current state of the files tracked by the watcher, including the offsets of swept files.
+func (w *Watcher) Checkpoint() *Checkpoint {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	c := &Checkpoint{Version: checkpointVersion, Files: make([]FileCheckpoint, 0, len(w.files.files)+len(w.swept))}
+	for _, fc := range w.swept {
+		fc.Head = append([]byte(nil), fc.Head...)
+		c.Files = append(c.Files, fc)
+	}
+	for _, f := range w.files.files {
+		c.Files = append(c.Files, FileCheckpoint{
+			Path:   f.path,
+			FileID: f.id,
+			Offset: f.size,
+			Head:   append([]byte(nil), f.scanner.head...),
+		})
+	}
+	return c
+}
+
+// restore initializes f from a checkpoint entry for the same file, or the offset kept when it was swept, if there is one.
+// Files are matched by identity, so files rotated while the exporter was stopped are restored
+// under their new name. The entry is ignored if the file was truncated since it was saved,
+// or if it was saved for another container, as the inode was reused by a new file.
+func (w *Watcher) restore(f *fileState, size int64) {
+	fc, ok := w.restored[f.id]
+	if ok {
+		delete(w.restored, f.id)
+	} else if fc, ok = w.swept[f.id]; ok {
+		delete(w.swept, f.id)
+	} else {
+		return
+	}
+	if fc.Offset > size || !w.sameContainer(fc.Path, f.labels) {
+		return
+	}
+	f.size = fc.Offset
+	f.scanner.restore(fc.Head)
+}
+
+// sameContainer returns true if path has the labels l. Rotation keeps files in their container directory,
+// so a file with the identity of a file saved for another container is a new file.
+func (w *Watcher) sameContainer(path string, l LogLabels) bool {
+	var saved LogLabels
+	return w.rules.Parse(path, &saved) && saved == l
+}
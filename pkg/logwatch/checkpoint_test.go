@@ -0,0 +1,92 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Empty(t, c.Files)
+
+	want := &Checkpoint{Version: checkpointVersion, Files: []FileCheckpoint{
+		{Path: "/var/log/pods/a/b/0.log", FileID: FileID{Dev: 1, Inode: 2}, Offset: 3, Head: []byte("x")},
+	}}
+	require.NoError(t, want.Save(path))
+	got, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// No temporary files left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99}`), 0600))
+	_, err = LoadCheckpoint(path)
+	assert.Error(t, err)
+}
+
+func TestWatcherRestoresCheckpoint(t *testing.T) {
+	w, path, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data+data), 0600)) },
+		func(path string) Options {
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			return Options{Checkpoint: &Checkpoint{Files: []FileCheckpoint{
+				{Path: path, FileID: fileIDOf(info), Offset: int64(len(data))},
+			}}}
+		})
+
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
+	require.NoError(t, err)
+	// Only the data after the checkpoint offset is counted.
+	assert.Equal(t, float64(len(data)), getCounterValue(counter))
+	writeToFile(t, path)
+	assert.Eventually(t,
+		func() bool { return float64(2*len(data)) == getCounterValue(counter) },
+		time.Second, time.Second/10, "%v != %v", 2*len(data), getCounterValue(counter))
+
+	c := w.Checkpoint()
+	require.Len(t, c.Files, 1)
+	assert.Equal(t, path, c.Files[0].Path)
+	assert.Equal(t, int64(3*len(data)), c.Files[0].Offset)
+}
+
+func TestWatcherIgnoresStaleCheckpoint(t *testing.T) {
+	w, _, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data), 0600)) },
+		func(path string) Options {
+			// Different inode, the file was replaced.
+			return Options{Checkpoint: &Checkpoint{Files: []FileCheckpoint{
+				{Path: path, FileID: FileID{Dev: 0, Inode: 0}, Offset: int64(len(data))},
+			}}}
+		})
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
+	require.NoError(t, err)
+	assert.Equal(t, float64(len(data)), getCounterValue(counter))
+}
+
+func TestWatcherIgnoresCheckpointOfOtherContainer(t *testing.T) {
+	w, _, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data+data), 0600)) },
+		func(path string) Options {
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			// Same inode, reused by a file of another container while the exporter was stopped.
+			other := filepath.Join(filepath.Dir(filepath.Dir(path)), "other", filepath.Base(path))
+			return Options{MetricPrefix: "reused_", Checkpoint: &Checkpoint{Files: []FileCheckpoint{
+				{Path: other, FileID: fileIDOf(info), Offset: int64(len(data))},
+			}}}
+		})
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
+	require.NoError(t, err)
+	assert.Equal(t, float64(2*len(data)), getCounterValue(counter))
+}
@@ -0,0 +1,72 @@
+package logwatch
+
+import (
+	"bytes"
+)
+
+// Stream is the output stream of a container log line.
+type Stream int
+
+const (
+	// UnknownStream is used for lines that are not in CRI format.
+	UnknownStream Stream = iota
+	Stdout
+	Stderr
+
+	numStreams = iota
+)
+
+var streamNames = [numStreams]string{"", "stdout", "stderr"}
+
+// String returns the CRI name of the stream, or "" for UnknownStream.
+func (s Stream) String() string { return streamNames[s] }
+
+// CRIHeader is the header of a line in the CRI log file format written by kubelet and CRI-O:
+//
+//	<timestamp> <stream> <tag>[:<tag>...] <content>
+//
+// The tag is "P" for a partial line that is continued on the next line, "F" for the final line of a record.
+type CRIHeader struct {
+	Timestamp []byte
+	Stream    Stream
+	Partial   bool
+	// Len is the length of the header including the space before the content.
+	Len int
+}
+
+// ParseCRIHeader parses the CRI header at the start of line.
+// Returns false if line does not start with a complete CRI header.
+func ParseCRIHeader(line []byte) (h CRIHeader, ok bool) {
+	rest := line
+	var fields [3][]byte
+	for i := range fields {
+		j := bytes.IndexByte(rest, ' ')
+		if j <= 0 {
+			return CRIHeader{}, false
+		}
+		fields[i], rest = rest[:j], rest[j+1:]
+	}
+	h.Timestamp = fields[0]
+	switch string(fields[1]) {
+	case "stdout":
+		h.Stream = Stdout
+	case "stderr":
+		h.Stream = Stderr
+	default:
+		return CRIHeader{}, false
+	}
+	tag := fields[2]
+	if i := bytes.IndexByte(tag, ':'); i >= 0 {
+		tag = tag[:i]
+	}
+	switch string(tag) {
+	case "P":
+		h.Partial = true
+	case "F":
+		h.Partial = false
+	default:
+		return CRIHeader{}, false
+	}
+	h.Len = len(line) - len(rest)
+	return h, true
+}
@@ -0,0 +1,31 @@
+package logwatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCRIHeader(t *testing.T) {
+	for _, x := range []struct {
+		line string
+		want CRIHeader
+		ok   bool
+	}{
+		{"2021-06-03T14:22:36.000000000+00:00 stdout F hello", CRIHeader{Timestamp: []byte("2021-06-03T14:22:36.000000000+00:00"), Stream: Stdout, Len: 45}, true},
+		{"2021-06-03T14:22:36.000000000+00:00 stderr P hello", CRIHeader{Timestamp: []byte("2021-06-03T14:22:36.000000000+00:00"), Stream: Stderr, Partial: true, Len: 45}, true},
+		{"2021-06-03T14:22:36Z stdout P:x ", CRIHeader{Timestamp: []byte("2021-06-03T14:22:36Z"), Stream: Stdout, Partial: true, Len: 32}, true},
+		{"2021-06-03T14:22:36Z stdout F", CRIHeader{}, false},
+		{"2021-06-03T14:22:36Z stdin F hello", CRIHeader{}, false},
+		{"2021-06-03T14:22:36Z stdout X hello", CRIHeader{}, false},
+		{" stdout F hello", CRIHeader{}, false},
+		{"hello world", CRIHeader{}, false},
+		{"", CRIHeader{}, false},
+	} {
+		t.Run(x.line, func(t *testing.T) {
+			h, ok := ParseCRIHeader([]byte(x.line))
+			assert.Equal(t, x.ok, ok)
+			assert.Equal(t, x.want, h)
+		})
+	}
+}
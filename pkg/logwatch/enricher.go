@@ -0,0 +1,21 @@
+package logwatch
+
+// Enricher adds metric labels for a container from a source other than the log file path,
+// for example Pod metadata from the Kubernetes API.
+type Enricher interface {
+	// LabelNames are the names of the added labels. They must not change.
+	LabelNames() []string
+	// LabelValues returns the values of the added labels for a container, in LabelNames order.
+	// Values that are not known are empty. It is called for each update, so it must be fast.
+	LabelValues(l LogLabels) []string
+}
+
+// streamValues returns the label values of the logged bytes, lines and records of a container stream,
+// including the enricher labels. Must be called with the mutex locked.
+func (w *Watcher) streamValues(l LogLabels, s Stream) []string {
+	values := l.values()
+	if w.enricher != nil {
+		values = append(values, w.enricher.LabelValues(l)...)
+	}
+	return append(values, s.String())
+}
@@ -0,0 +1,27 @@
+package logwatch
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEnricher map[LogLabels]string
+
+func (e fakeEnricher) LabelNames() []string             { return []string{"owner_name"} }
+func (e fakeEnricher) LabelValues(l LogLabels) []string { return []string{e[l]} }
+
+// The enricher labels change the metric label names, which a registry does not allow under the same name.
+func TestWatcherEnricher(t *testing.T) {
+	e := fakeEnricher{}
+	w, _, l := setupWithOptions(t, func(path string) {
+		var l LogLabels
+		l.Parse(path)
+		e[l] = "prometheus"
+		writeToFile(t, path)
+	}, func(string) Options { return Options{MetricPrefix: "enriched_", Enricher: e} })
+	values := append(l.values(), "prometheus", UnknownStream.String())
+	assert.Equal(t, float64(len(data)), testutil.ToFloat64(w.metrics.WithLabelValues(values...)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.lines.WithLabelValues(values...)))
+}
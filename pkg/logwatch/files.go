@@ -0,0 +1,141 @@
+package logwatch
+
+import (
+	"sync"
+	"time"
+)
+
+// rotationGrace is how long the state of a file that disappeared from its path is kept.
+// A rotated file is renamed, the state is kept so the file is not counted again
+// when it is seen under its new name.
+const rotationGrace = time.Minute
+
+// fileState is the last known state of a log file.
+//
+// The size and scanner are changed with both the file mutex and the watcher mutex locked,
+// so they can be read with either of them.
+type fileState struct {
+	mutex    sync.Mutex // Held while the file is read.
+	labels   LogLabels
+	path     string // Current path, or last known path if detached.
+	id       FileID
+	size     int64 // Offset up to which the file has been counted.
+	scanner  lineScanner
+	detached time.Time // Time the file disappeared from path, zero if attached.
+	// collected is the last known collector position, -1 if unknown.
+	collected int64
+}
+
+// fileTable tracks log files by identity (device and inode), so a file is counted exactly once
+// when it is renamed by log rotation, and concurrent files for the same container
+// (e.g. 0.log and 1.log after a container restart, or 0.log and its rotated copy)
+// do not interfere with each other.
+//
+// It is not safe for concurrent use, callers must synchronize.
+type fileTable struct {
+	files    map[FileID]*fileState
+	paths    map[string]FileID     // Files attached to a path.
+	detached map[FileID]*fileState // Files that disappeared from their path within rotationGrace.
+	series   map[LogLabels]int     // Number of files per container.
+}
+
+func newFileTable() fileTable {
+	return fileTable{
+		files:    make(map[FileID]*fileState),
+		paths:    make(map[string]FileID),
+		detached: make(map[FileID]*fileState),
+		series:   make(map[LogLabels]int),
+	}
+}
+
+// attach returns the state for the file id at path, creating it if the file is new.
+// isNew is true if the file was not previously tracked, renamed is true if it was tracked under another path.
+// If path was attached to a different file, that file is detached.
+//
+// Rotation keeps files in their container directory, so a tracked file seen with the labels of another container
+// was deleted and its inode reused. Its state is deleted, calling deleted if not nil, and the file is new.
+func (t *fileTable) attach(path string, id FileID, labels LogLabels, deleted func(f *fileState, last bool)) (f *fileState, isNew, renamed bool) {
+	if old, ok := t.paths[path]; ok && old != id {
+		t.detach(path)
+	}
+	f = t.files[id]
+	if f != nil && f.labels != labels {
+		last := t.delete(f)
+		if deleted != nil {
+			deleted(f, last)
+		}
+		f = nil
+	}
+	if f == nil {
+		f = &fileState{labels: labels, id: id, collected: -1}
+		t.files[id] = f
+		t.series[labels]++
+		isNew = true
+	} else if f.path != path {
+		if t.paths[f.path] == id {
+			delete(t.paths, f.path)
+		}
+		renamed = true
+	}
+	f.path, f.detached = path, time.Time{}
+	delete(t.detached, id)
+	t.paths[path] = id
+	return f, isNew, renamed
+}
+
+// detach the file at path, keeping its state for rotationGrace in case it re-appears under a new path.
+func (t *fileTable) detach(path string) {
+	id, ok := t.paths[path]
+	if !ok {
+		return
+	}
+	delete(t.paths, path)
+	f := t.files[id]
+	f.detached = time.Now()
+	t.detached[id] = f
+}
+
+// remove the state of the file last seen at path.
+// Returns the removed file, nil if there is none, and true if this was the last file for the container.
+func (t *fileTable) remove(path string) (*fileState, bool) {
+	id, ok := t.paths[path]
+	if !ok {
+		// May have been detached before the remove event arrived.
+		for did, f := range t.detached {
+			if f.path == path {
+				id, ok = did, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	f := t.files[id]
+	return f, t.delete(f)
+}
+
+// delete the file state, returns true if this was the last file for the container.
+func (t *fileTable) delete(f *fileState) bool {
+	if t.paths[f.path] == f.id {
+		delete(t.paths, f.path)
+	}
+	delete(t.files, f.id)
+	delete(t.detached, f.id)
+	t.series[f.labels]--
+	if t.series[f.labels] > 0 {
+		return false
+	}
+	delete(t.series, f.labels)
+	return true
+}
+
+// expire deletes detached files older than rotationGrace.
+// Calls deleted for each expired file, last is true if it was the last file for the container.
+func (t *fileTable) expire(now time.Time, deleted func(f *fileState, last bool)) {
+	for _, f := range t.detached {
+		if now.Sub(f.detached) > rotationGrace {
+			deleted(f, t.delete(f))
+		}
+	}
+}
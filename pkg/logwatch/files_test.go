@@ -0,0 +1,105 @@
+package logwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTableRotation(t *testing.T) {
+	table := newFileTable()
+	l := LogLabels{Namespace: "ns", Name: "pod", UUID: "1234", Container: "c"}
+	id0, id1 := FileID{Dev: 1, Inode: 1}, FileID{Dev: 1, Inode: 2}
+
+	f0, isNew, _ := table.attach("0.log", id0, l, nil)
+	assert.True(t, isNew)
+	f0.size = 10
+
+	// Rotated: 0.log is renamed and a new 0.log is created.
+	f1, isNew, renamed := table.attach("0.log", id1, l, nil)
+	assert.True(t, isNew)
+	assert.False(t, renamed)
+	assert.NotSame(t, f0, f1)
+	assert.Contains(t, table.detached, id0)
+	f, isNew, renamed := table.attach("0.log.20261018-120000", id0, l, nil)
+	assert.False(t, isNew)
+	assert.True(t, renamed)
+	assert.Same(t, f0, f)
+	assert.Equal(t, int64(10), f.size)
+	assert.Empty(t, table.detached)
+	assert.Equal(t, 2, table.series[l])
+
+	// Removing the rotated file keeps the container.
+	f, last := table.remove("0.log.20261018-120000")
+	assert.Same(t, f0, f)
+	assert.False(t, last)
+	f, last = table.remove("0.log")
+	assert.Same(t, f1, f)
+	assert.True(t, last)
+	assert.Empty(t, table.files)
+	assert.Empty(t, table.paths)
+}
+
+func TestFileTableRenameBeforeCreate(t *testing.T) {
+	table := newFileTable()
+	l := LogLabels{Namespace: "ns", Name: "pod", UUID: "1234", Container: "c"}
+	id := FileID{Dev: 1, Inode: 1}
+	table.attach("0.log", id, l, nil)
+	// The renamed file is seen at its new path before the old path is updated.
+	f, isNew, renamed := table.attach("0.log.20261018-120000", id, l, nil)
+	assert.False(t, isNew)
+	assert.True(t, renamed)
+	assert.Equal(t, "0.log.20261018-120000", f.path)
+	assert.Equal(t, map[string]FileID{"0.log.20261018-120000": id}, table.paths)
+	table.detach("0.log") // No longer attached, no effect.
+	assert.Empty(t, table.detached)
+}
+
+func TestFileTableInodeReused(t *testing.T) {
+	table := newFileTable()
+	l0 := LogLabels{Namespace: "ns", Name: "pod", UUID: "1234", Container: "c0"}
+	l1 := LogLabels{Namespace: "ns", Name: "pod", UUID: "1234", Container: "c1"}
+	id := FileID{Dev: 1, Inode: 1}
+	f0, _, _ := table.attach("c0/0.log", id, l0, nil)
+	f0.size = 10
+
+	// The inode is seen in another container, the file was deleted and the inode reused.
+	var deleted []*fileState
+	f, isNew, renamed := table.attach("c1/0.log", id, l1, func(f *fileState, last bool) {
+		assert.True(t, last)
+		deleted = append(deleted, f)
+	})
+	assert.True(t, isNew)
+	assert.False(t, renamed)
+	assert.NotSame(t, f0, f)
+	assert.Equal(t, int64(0), f.size)
+	assert.Equal(t, []*fileState{f0}, deleted)
+	assert.Equal(t, map[LogLabels]int{l1: 1}, table.series)
+	assert.Equal(t, map[string]FileID{"c1/0.log": id}, table.paths)
+}
+
+func TestFileTableExpire(t *testing.T) {
+	table := newFileTable()
+	l := LogLabels{Namespace: "ns", Name: "pod", UUID: "1234", Container: "c"}
+	f, _, _ := table.attach("0.log", FileID{Dev: 1, Inode: 1}, l, nil)
+	table.detach("0.log")
+	var expired []*fileState
+	deleted := func(f *fileState, last bool) {
+		assert.True(t, last)
+		expired = append(expired, f)
+	}
+	table.expire(time.Now(), deleted)
+	assert.Empty(t, expired)
+	table.expire(time.Now().Add(2*rotationGrace), deleted)
+	assert.Equal(t, []*fileState{f}, expired)
+	assert.Empty(t, table.files)
+
+	// A remove event after detach removes the detached file.
+	f, _, _ = table.attach("0.log", FileID{Dev: 1, Inode: 2}, l, nil)
+	table.detach("0.log")
+	got, last := table.remove("0.log")
+	assert.True(t, last)
+	assert.Same(t, f, got)
+	assert.Empty(t, table.detached)
+}
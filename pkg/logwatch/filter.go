@@ -0,0 +1,88 @@
+package logwatch
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Filter selects the containers to watch by namespace, pod and container name.
+// Files of containers that are not selected are ignored.
+type Filter struct {
+	Namespaces Match `json:"namespaces,omitempty"`
+	Pods       Match `json:"pods,omitempty"`
+	Containers Match `json:"containers,omitempty"`
+}
+
+// Match selects names by include and exclude patterns.
+// A name matches if it matches any include pattern, or there are none, and matches no exclude pattern.
+//
+// Patterns are shell globs (see path.Match), or regular expressions if enclosed in slashes: "/^openshift-.*/".
+type Match struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	include, exclude []func(string) bool
+}
+
+// Compile and validate the filter patterns. Filters must be compiled before they are used.
+func (f *Filter) Compile() error {
+	for name, m := range map[string]*Match{"namespaces": &f.Namespaces, "pods": &f.Pods, "containers": &f.Containers} {
+		if err := m.compile(); err != nil {
+			return fmt.Errorf("invalid %v filter: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Allows returns true if the filter selects the container. A nil filter allows everything.
+func (f *Filter) Allows(l LogLabels) bool {
+	return f == nil || (f.Namespaces.matches(l.Namespace) && f.Pods.matches(l.Name) && f.Containers.matches(l.Container))
+}
+
+func (m *Match) compile() (err error) {
+	if m.include, err = compilePatterns(m.Include); err == nil {
+		m.exclude, err = compilePatterns(m.Exclude)
+	}
+	return err
+}
+
+func (m *Match) matches(name string) bool {
+	if len(m.include) > 0 && !matchesAny(m.include, name) {
+		return false
+	}
+	return !matchesAny(m.exclude, name)
+}
+
+func matchesAny(matchers []func(string) bool, name string) bool {
+	for _, match := range matchers {
+		if match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]func(string) bool, error) {
+	matchers := make([]func(string) bool, 0, len(patterns))
+	for _, p := range patterns {
+		if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			re, err := regexp.Compile(p[1 : len(p)-1])
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q", err, p)
+		}
+		glob := p
+		matchers = append(matchers, func(name string) bool {
+			ok, _ := path.Match(glob, name)
+			return ok
+		})
+	}
+	return matchers, nil
+}
@@ -0,0 +1,68 @@
+package logwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	f := &Filter{
+		Namespaces: Match{Include: []string{"tenant-*", "/^team-[0-9]+$/"}, Exclude: []string{"tenant-noisy"}},
+		Containers: Match{Exclude: []string{"istio-proxy"}},
+	}
+	require.NoError(t, f.Compile())
+	for _, x := range []struct {
+		labels LogLabels
+		want   bool
+	}{
+		{LogLabels{Namespace: "tenant-a", Name: "p", Container: "c"}, true},
+		{LogLabels{Namespace: "team-12", Name: "p", Container: "c"}, true},
+		{LogLabels{Namespace: "team-x", Name: "p", Container: "c"}, false},
+		{LogLabels{Namespace: "tenant-noisy", Name: "p", Container: "c"}, false},
+		{LogLabels{Namespace: "openshift-logging", Name: "p", Container: "c"}, false},
+		{LogLabels{Namespace: "tenant-a", Name: "p", Container: "istio-proxy"}, false},
+	} {
+		assert.Equal(t, x.want, f.Allows(x.labels), "%+v", x.labels)
+	}
+	var none *Filter
+	assert.True(t, none.Allows(LogLabels{}))
+}
+
+func TestFilterInvalid(t *testing.T) {
+	assert.Error(t, (&Filter{Pods: Match{Include: []string{"/(/"}}}).Compile())
+	assert.Error(t, (&Filter{Containers: Match{Exclude: []string{"["}}}).Compile())
+}
+
+func TestWatcherFilter(t *testing.T) {
+	exclude := &Filter{Namespaces: Match{Exclude: []string{"openshift-*"}}}
+	require.NoError(t, exclude.Compile())
+	w, path, l := setupWithOptions(t,
+		func(path string) { writeToFile(t, path) },
+		func(string) Options { return Options{Filter: exclude} })
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "log_logged_bytes_total")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Reload with a filter that includes the file.
+	require.NoError(t, w.SetFilter(nil))
+	assert.Equal(t, float64(len(data)), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)))
+	writeToFile(t, path)
+	assert.Eventually(t,
+		func() bool {
+			return float64(2*len(data)) == testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...))
+		},
+		time.Second, time.Second/10)
+
+	// Exclude again, the series is removed and new writes are ignored.
+	require.NoError(t, w.SetFilter(exclude))
+	writeToFile(t, path)
+	time.Sleep(time.Second / 10)
+	n, err = testutil.GatherAndCount(prometheus.DefaultGatherer, "log_logged_bytes_total")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
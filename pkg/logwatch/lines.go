@@ -0,0 +1,129 @@
+package logwatch
+
+import (
+	"bytes"
+	"io"
+)
+
+// maxHead is the number of bytes kept from the start of a line that is still being written.
+// It only needs to be large enough to hold the CRI header.
+const maxHead = 64
+
+// lineScanner counts bytes, lines and records per stream in data appended to a log file.
+//
+// A line is any newline-terminated sequence of bytes. A record is a complete log entry:
+// CRI runtimes split long entries into several "P" (partial) lines followed by a final "F" line,
+// the partial lines are counted as lines but not as records.
+//
+// Bytes are attributed to the stream of the line they belong to as soon as the stream is known.
+type lineScanner struct {
+	head    []byte // Start of the line in progress, at most maxHead bytes.
+	pending int64  // Bytes of the line in progress not yet attributed to a stream.
+	known   bool   // True if the header of the line in progress has been parsed.
+	header  CRIHeader
+}
+
+// streamCounts are the bytes, lines and records found for one stream.
+type streamCounts struct {
+	bytes, lines, records float64
+}
+
+// lineCounts are the counts found by a lineScanner, indexed by Stream.
+type lineCounts [numStreams]streamCounts
+
+func (c *lineCounts) add(more lineCounts) {
+	for i := range c {
+		c[i].bytes += more[i].bytes
+		c[i].lines += more[i].lines
+		c[i].records += more[i].records
+	}
+}
+
+// scan counts data, carrying incomplete lines over to the next call.
+func (s *lineScanner) scan(data []byte) (c lineCounts) {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		line := data
+		if i >= 0 {
+			line = data[:i]
+		}
+		if s.known {
+			c[s.header.Stream].bytes += float64(len(line))
+		} else {
+			s.keep(line)
+			s.pending += int64(len(line))
+			if h, ok := ParseCRIHeader(s.head); ok || len(s.head) >= maxHead {
+				s.resolve(h, &c)
+			}
+		}
+		if i < 0 {
+			return c
+		}
+		if !s.known {
+			// A complete line with no content may lack the space after the tag.
+			h, _ := ParseCRIHeader(append(s.head, ' '))
+			s.resolve(h, &c)
+		}
+		st := &c[s.header.Stream]
+		st.bytes++ // Newline
+		st.lines++
+		if !s.header.Partial {
+			st.records++
+		}
+		*s = lineScanner{head: s.head[:0]}
+		data = data[i+1:]
+	}
+	return c
+}
+
+// resolve sets the header of the line in progress and attributes pending bytes to its stream.
+func (s *lineScanner) resolve(h CRIHeader, c *lineCounts) {
+	s.header, s.known = h, true
+	c[h.Stream].bytes += float64(s.pending)
+	s.pending = 0
+}
+
+// restore the scanner state for a line in progress with the given head.
+func (s *lineScanner) restore(head []byte) {
+	*s = lineScanner{head: append([]byte(nil), head...), pending: int64(len(head))}
+	if h, ok := ParseCRIHeader(s.head); ok || len(s.head) >= maxHead {
+		s.header, s.known, s.pending = h, true, 0
+	}
+}
+
+// clone returns a copy of the scanner that does not share its head.
+func (s lineScanner) clone() lineScanner {
+	s.head = append([]byte(nil), s.head...)
+	return s
+}
+
+// keep appends the start of data to the head of the line in progress.
+func (s *lineScanner) keep(data []byte) {
+	if n := maxHead - len(s.head); n > 0 {
+		if len(data) > n {
+			data = data[:n]
+		}
+		s.head = append(s.head, data...)
+	}
+}
+
+// readRange reads f from offset up to size, passing the data to s.
+// Returns the new offset, which is less than size if the file was truncated while reading.
+func readRange(f io.ReaderAt, offset, size int64, s *lineScanner) (int64, lineCounts, error) {
+	var c lineCounts
+	r := io.NewSectionReader(f, offset, size-offset)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			c.add(s.scan(buf[:n]))
+			offset += int64(n)
+		}
+		switch {
+		case err == io.EOF:
+			return offset, c, nil
+		case err != nil:
+			return offset, c, err
+		}
+	}
+}
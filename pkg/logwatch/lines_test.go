@@ -0,0 +1,53 @@
+package logwatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	partialLine = "2021-06-03T14:22:36.000000000+00:00 stdout P hello "
+	finalLine   = "2021-06-03T14:22:36.000000000+00:00 stderr F:x world\n"
+)
+
+func TestLineScanner(t *testing.T) {
+	var s lineScanner
+	var want lineCounts
+	// Bytes are held until the header is complete.
+	assert.Equal(t, want, s.scan([]byte(partialLine[:20])))
+	want[Stdout] = streamCounts{bytes: float64(len(partialLine))}
+	assert.Equal(t, want, s.scan([]byte(partialLine[20:])))
+	want[Stdout] = streamCounts{bytes: 1, lines: 1}
+	assert.Equal(t, want, s.scan([]byte("\n")))
+
+	want = lineCounts{}
+	want[Stderr] = streamCounts{bytes: float64(len(finalLine)), lines: 1, records: 1}
+	want[UnknownStream] = streamCounts{bytes: 8, lines: 1, records: 1}
+	assert.Equal(t, want, s.scan([]byte(finalLine+"not cri\nincomplete")))
+
+	want = lineCounts{}
+	want[UnknownStream] = streamCounts{bytes: 11, lines: 1, records: 1}
+	assert.Equal(t, want, s.scan([]byte("\n")))
+}
+
+func TestLineScannerEmptyContent(t *testing.T) {
+	var s lineScanner
+	var want lineCounts
+	line := "2021-06-03T14:22:36.000000000+00:00 stderr F\n"
+	want[Stderr] = streamCounts{bytes: float64(len(line)), lines: 1, records: 1}
+	assert.Equal(t, want, s.scan([]byte(line)))
+}
+
+func TestLineScannerRestore(t *testing.T) {
+	var s lineScanner
+	s.scan([]byte(partialLine))
+	var restored lineScanner
+	restored.restore(s.head)
+	assert.Equal(t, s, restored)
+
+	s = lineScanner{}
+	s.scan([]byte(partialLine[:20]))
+	restored.restore(s.head)
+	assert.Equal(t, s, restored)
+}
@@ -18,3 +18,12 @@ func TestParseLogLabels(t *testing.T) {
 	}
 	assert.Equal(t, want, l)
 }
+
+func TestParseLogLabelsRotated(t *testing.T) {
+	dir := "/var/log/pods/test-qegihyox_functional_19b40c1b-df6d-4e63-b5aa-d6c5ed20ac4e/something/"
+	var l LogLabels
+	assert.True(t, l.Parse(dir+"0.log.20261018-120000"))
+	assert.False(t, l.Parse(dir+"0.log.20261018-120000.gz"))
+	assert.False(t, l.Parse(dir+"0.log.tmp"))
+	assert.False(t, l.Parse(dir))
+}
@@ -0,0 +1,27 @@
+package logwatch
+
+const overflowValue = "__overflow__"
+
+// overflowLabels are the labels of the series that aggregates containers beyond the series limit.
+var overflowLabels = LogLabels{Namespace: overflowValue, Name: overflowValue, UUID: overflowValue, Container: overflowValue}
+
+// admit a new container, or add it to the overflow series if the series limit is reached.
+// Must be called with the mutex locked, after the first file of the container is added.
+func (w *Watcher) admit(l LogLabels) {
+	if w.maxSeries <= 0 {
+		return
+	}
+	if exported := len(w.files.series) - len(w.overflowed); exported > w.maxSeries {
+		w.overflowed[l] = true
+		w.dropped.Inc()
+	}
+}
+
+// seriesLabels returns the labels of the series used for the container.
+// Must be called with the mutex locked.
+func (w *Watcher) seriesLabels(l LogLabels) LogLabels {
+	if w.overflowed[l] {
+		return overflowLabels
+	}
+	return l
+}
@@ -0,0 +1,49 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherMaxSeries(t *testing.T) {
+	w, path, l := setupWithOptions(t,
+		func(path string) { writeToFile(t, path) },
+		func(string) Options { return Options{MaxSeries: 1} })
+	bytes := func(l LogLabels) float64 {
+		return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...))
+	}
+	assert.Equal(t, float64(len(data)), bytes(l))
+
+	// Two more containers go to the overflow series.
+	podDir := filepath.Dir(filepath.Dir(path))
+	other1 := filepath.Join(podDir, "other1", "0.log")
+	other2 := filepath.Join(podDir, "other2", "0.log")
+	for _, p := range []string{other1, other2} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+	}
+	time.Sleep(time.Second / 10) // Let the watcher start watching the new directories.
+	for _, p := range []string{other1, other2} {
+		writeToFile(t, p)
+	}
+	assert.Eventually(t, func() bool { return bytes(overflowLabels) == float64(2*len(data)) },
+		time.Second, time.Second/10, "%v != %v", bytes(overflowLabels), 2*len(data))
+	assert.Equal(t, float64(2), testutil.ToFloat64(w.dropped))
+	assert.Equal(t, float64(len(data)), bytes(l))
+
+	// The overflow series is removed with its last container.
+	for _, p := range []string{other1, other2} {
+		require.NoError(t, os.Remove(p))
+	}
+	assert.Eventually(t, func() bool {
+		n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "log_logged_bytes_total")
+		require.NoError(t, err)
+		return n == 1
+	}, time.Second, time.Second/10)
+}
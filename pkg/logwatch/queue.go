@@ -0,0 +1,151 @@
+package logwatch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWorkers is the default number of goroutines processing events.
+const DefaultWorkers = 5
+
+// eventQueue holds the pending events of each path, so that a path is processed once
+// for a burst of events, e.g. many writes to a busy log file.
+// Paths are processed in the order they were first queued, at least delay after that.
+// A path is never returned again before done is called for it, so it is not processed by two workers at once.
+// Events for a path that is being processed are queued when it is done.
+type eventQueue struct {
+	delay   time.Duration
+	mutex   sync.Mutex
+	ready   *sync.Cond
+	order   []queued
+	pending map[string]fsnotify.Op // Merged operations of queued paths.
+	active  map[string]bool        // Paths being processed.
+	closed  bool                   // No more events are accepted.
+	drain   bool                   // Queued paths are returned without delay until the queue is empty.
+	stop    chan struct{}          // Closed when the queue is closed, to interrupt delays.
+}
+
+type queued struct {
+	path string
+	at   time.Time
+}
+
+func newEventQueue(delay time.Duration) *eventQueue {
+	q := &eventQueue{delay: delay, pending: make(map[string]fsnotify.Op), active: make(map[string]bool), stop: make(chan struct{})}
+	q.ready = sync.NewCond(&q.mutex)
+	return q
+}
+
+// push an event, merging it with the pending events for the same path.
+// A removal replaces pending changes, since the file can no longer be read.
+// Changes after a removal are kept with it, the old file is forgotten before the new one is updated.
+// Returns true if the event was merged, events are dropped if the queue is closed.
+func (q *eventQueue) push(e fsnotify.Event) (merged bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return false
+	}
+	op, ok := q.pending[e.Name]
+	switch {
+	case e.Op == fsnotify.Remove:
+		op = fsnotify.Remove
+	case op&fsnotify.Remove != 0:
+		op = fsnotify.Remove | fsnotify.Create
+	default:
+		op |= e.Op
+	}
+	q.pending[e.Name] = op
+	if !ok && !q.active[e.Name] {
+		q.order = append(q.order, queued{path: e.Name, at: time.Now()})
+		q.ready.Signal()
+	}
+	return ok
+}
+
+// done marks a path returned by pop as processed, events received while it was processed are queued.
+func (q *eventQueue) done(path string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.active, path)
+	if _, ok := q.pending[path]; ok {
+		q.order = append(q.order, queued{path: path, at: time.Now()})
+		q.ready.Signal()
+	}
+}
+
+// pop waits for the next path to process and returns it with its merged operations,
+// done must be called when the path has been processed.
+// Returns false when the queue is closed, or drained and empty.
+func (q *eventQueue) pop() (path string, op fsnotify.Op, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for {
+		for len(q.order) == 0 && !q.closed {
+			q.ready.Wait()
+		}
+		if len(q.order) == 0 || (q.closed && !q.drain) {
+			return "", 0, false
+		}
+		if wait := q.delay - time.Since(q.order[0].at); wait > 0 && !q.drain {
+			q.mutex.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-q.stop:
+				timer.Stop()
+			}
+			q.mutex.Lock()
+			continue
+		}
+		path = q.order[0].path
+		q.order = q.order[1:]
+		op = q.pending[path]
+		delete(q.pending, path)
+		q.active[path] = true
+		return path, op, true
+	}
+}
+
+// len returns the number of paths with pending events.
+func (q *eventQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// oldest returns the time the oldest queued path was queued, zero if the queue is empty.
+func (q *eventQueue) oldest() time.Time {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.order) == 0 {
+		return time.Time{}
+	}
+	return q.order[0].at
+}
+
+// close the queue, pending events are dropped and pop returns false.
+func (q *eventQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.shut()
+}
+
+// closeAndDrain closes the queue, pop returns the pending events without delay, then false.
+func (q *eventQueue) closeAndDrain() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.drain = true
+	q.shut()
+}
+
+// shut closes the queue, must be called with the mutex locked.
+func (q *eventQueue) shut() {
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.ready.Broadcast()
+}
@@ -0,0 +1,178 @@
+package logwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQueueMerge(t *testing.T) {
+	q := newEventQueue(0)
+	assert.False(t, q.push(fsnotify.Event{Name: "a", Op: fsnotify.Create}))
+	assert.False(t, q.push(fsnotify.Event{Name: "b", Op: fsnotify.Write}))
+	assert.True(t, q.push(fsnotify.Event{Name: "a", Op: fsnotify.Write}))
+	assert.False(t, q.push(fsnotify.Event{Name: "c", Op: fsnotify.Write}))
+	assert.True(t, q.push(fsnotify.Event{Name: "c", Op: fsnotify.Remove}))
+	assert.False(t, q.push(fsnotify.Event{Name: "d", Op: fsnotify.Remove}))
+	assert.True(t, q.push(fsnotify.Event{Name: "d", Op: fsnotify.Create}))
+	assert.True(t, q.push(fsnotify.Event{Name: "d", Op: fsnotify.Write}))
+	assert.Equal(t, 4, q.len())
+
+	for _, want := range []struct {
+		path string
+		op   fsnotify.Op
+	}{
+		{"a", fsnotify.Create | fsnotify.Write},
+		{"b", fsnotify.Write},
+		{"c", fsnotify.Remove},
+		{"d", fsnotify.Remove | fsnotify.Create},
+	} {
+		path, op, ok := q.pop()
+		require.True(t, ok)
+		assert.Equal(t, want.path, path)
+		assert.Equal(t, want.op, op, "%v: %v", path, op)
+	}
+	assert.Equal(t, 0, q.len())
+
+	done := make(chan bool)
+	go func() {
+		_, _, ok := q.pop()
+		done <- ok
+	}()
+	q.close()
+	assert.False(t, <-done)
+}
+
+func TestEventQueueActive(t *testing.T) {
+	q := newEventQueue(0)
+	q.push(fsnotify.Event{Name: "a", Op: fsnotify.Write})
+	path, _, ok := q.pop()
+	require.True(t, ok)
+	require.Equal(t, "a", path)
+
+	// An event for a path being processed is held until the path is done.
+	assert.False(t, q.push(fsnotify.Event{Name: "a", Op: fsnotify.Write}))
+	q.push(fsnotify.Event{Name: "b", Op: fsnotify.Write})
+	assert.Equal(t, 2, q.len())
+	path, _, ok = q.pop()
+	require.True(t, ok)
+	assert.Equal(t, "b", path)
+	assert.True(t, q.oldest().IsZero())
+
+	q.done("a")
+	path, op, ok := q.pop()
+	require.True(t, ok)
+	assert.Equal(t, "a", path)
+	assert.Equal(t, fsnotify.Write, op)
+	assert.Equal(t, 0, q.len())
+}
+
+func TestEventQueueDelay(t *testing.T) {
+	delay := time.Second / 10
+	q := newEventQueue(delay)
+	start := time.Now()
+	q.push(fsnotify.Event{Name: "a", Op: fsnotify.Write})
+	path, _, ok := q.pop()
+	require.True(t, ok)
+	assert.Equal(t, "a", path)
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+}
+
+func TestWatcherCoalescesWrites(t *testing.T) {
+	w, path, l := setupWithOptions(t, nil, func(string) Options {
+		return Options{MetricPrefix: "coalesced_", Workers: 1, CoalesceDelay: time.Second / 2}
+	})
+	for i := 0; i < 5; i++ {
+		writeToFile(t, path)
+	}
+	bytes := func() float64 { return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)) }
+	assert.Eventually(t, func() bool { return bytes() == float64(5*len(data)) }, 2*time.Second, time.Second/10)
+	assert.Greater(t, testutil.ToFloat64(w.self.coalesced), float64(0))
+}
+
+func TestWatcherWatchDrainsOnCancel(t *testing.T) {
+	w, events, dir := setupFake(t, Options{MetricPrefix: "drained_", CoalesceDelay: time.Hour})
+	path := filepath.Join(dir, logname)
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx) }()
+	events.Send(fsnotify.Event{Name: path, Op: fsnotify.Create})
+	require.Eventually(t, func() bool { return events.Pending() == 0 && w.queue.len() == 1 }, time.Second, time.Second/100)
+
+	// The queued event is processed without waiting for the delay.
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "Watch did not return")
+	}
+	assert.Equal(t, float64(len(data)), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)))
+}
+
+func TestWatcherHealthy(t *testing.T) {
+	w, _, dir := setupFake(t, Options{MetricPrefix: "healthy_"})
+	assert.EqualError(t, w.Healthy(time.Second), "not watching")
+
+	// Simulate a running Watch with stuck workers.
+	w.watching.Store(true)
+	assert.NoError(t, w.Healthy(time.Second))
+	w.queue.push(fsnotify.Event{Name: filepath.Join(dir, logname), Op: fsnotify.Write})
+	time.Sleep(time.Second / 100)
+	assert.NoError(t, w.Healthy(time.Hour))
+	assert.ErrorContains(t, w.Healthy(time.Millisecond), "event queued for")
+}
+
+func TestWatcherWatchRemoveCreate(t *testing.T) {
+	w, events, dir := setupFake(t, Options{MetricPrefix: "remove_create_", Workers: 2, CoalesceDelay: time.Hour})
+	path := filepath.Join(dir, logname)
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	bytes := func() float64 { return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)) }
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(data+data), 0600))
+	require.NoError(t, w.Update(path))
+	require.Equal(t, float64(2*len(data)), bytes())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx) }()
+
+	// The file is replaced by a shorter one, the events are merged in the queue.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	events.Send(
+		fsnotify.Event{Name: path, Op: fsnotify.Remove},
+		fsnotify.Event{Name: path, Op: fsnotify.Create},
+		fsnotify.Event{Name: path, Op: fsnotify.Write})
+	require.Eventually(t, func() bool { return events.Pending() == 0 && w.queue.len() == 1 }, time.Second, time.Second/100)
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "Watch did not return")
+	}
+
+	// The removed file is forgotten with its series before the new file is counted, it is not a truncation.
+	assert.Equal(t, float64(len(data)), bytes())
+	assert.Equal(t, 0, testutil.CollectAndCount(w.rotations))
+	assert.Len(t, w.files.files, 1)
+	assert.Equal(t, float64(2), testutil.ToFloat64(w.self.coalesced))
+	for _, op := range []string{"remove", "create", "write"} {
+		assert.Equal(t, float64(1), testutil.ToFloat64(w.self.events.WithLabelValues(op)), op)
+	}
+	assert.Equal(t, 0, w.queue.len())
+}
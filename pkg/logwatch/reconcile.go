@@ -0,0 +1,63 @@
+package logwatch
+
+import (
+	"os"
+	"time"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+)
+
+// reconcileEvery reconciles every interval, if not 0, and when requested, until the watcher is closed.
+func (w *Watcher) reconcileEvery(interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-tick:
+		case <-w.reconciles:
+		}
+		if err := w.reconcile(); err != nil {
+			log.Error(err, "error reconciling watch dir", "dir", w.dir)
+		}
+	}
+}
+
+// requestReconcile requests a reconciliation without waiting for it,
+// requests made while one is pending are merged.
+func (w *Watcher) requestReconcile() {
+	select {
+	case w.reconciles <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile recovers from missed events: watches are added for all directories,
+// every file is updated, and files that no longer exist are forgotten.
+func (w *Watcher) reconcile() error {
+	log.V(3).Info("reconciling watch dir", "dir", w.dir)
+	w.self.reconciles.Inc()
+	if err := w.watcher.Add(w.dir); err != nil {
+		return err
+	}
+	if err := w.walk(); err != nil {
+		return err
+	}
+	w.mutex.RLock()
+	paths := make([]string, 0, len(w.files.paths))
+	for path := range w.files.paths {
+		paths = append(paths, path)
+	}
+	w.mutex.RUnlock()
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			w.Forget(path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherReconcile(t *testing.T) {
+	w, events, dir := setupFake(t, Options{MetricPrefix: "reconciled_"})
+	path := filepath.Join(dir, logname)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+	process(w, events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	bytes := func(l LogLabels) float64 {
+		return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...))
+	}
+
+	// Events are lost, changed and new files are counted when the queue overflows.
+	writeToFile(t, path)
+	other := filepath.Join(filepath.Dir(filepath.Dir(path)), "other", "0.log")
+	require.NoError(t, os.MkdirAll(filepath.Dir(other), 0700))
+	writeToFile(t, other)
+	events.SendError(fsnotify.ErrEventOverflow)
+	process(w, events)
+	var o LogLabels
+	require.True(t, o.Parse(other))
+	assert.Eventually(t, func() bool { return bytes(o) == float64(len(data)) }, time.Second, time.Second/10)
+	assert.Equal(t, float64(2*len(data)), bytes(l))
+
+	// Files that no longer exist are forgotten.
+	require.NoError(t, os.Remove(other))
+	require.NoError(t, w.reconcile())
+	assert.Equal(t, 1, testutil.CollectAndCount(w.metrics))
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	assert.NotContains(t, w.files.paths, other)
+}
+
+func TestWatcherReconcileWhileAppending(t *testing.T) {
+	w, _, dir := setupFake(t, Options{MetricPrefix: "reconciled_appending_"})
+	path := filepath.Join(dir, logname)
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+
+	// Reconciles run concurrently with updates of the same file by the workers.
+	var calls atomic.Int32
+	n := 0
+	for i := 0; i < 5; i++ { // Races are not detected every time.
+		n += appendConcurrently(t, path, func() {
+			if calls.Add(1)%2 == 0 {
+				assert.NoError(t, w.reconcile())
+			} else {
+				assert.NoError(t, w.Update(path))
+			}
+		})
+	}
+	assert.Equal(t, float64(n), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(Stdout)...)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(w.rotations.WithLabelValues(l.values()...)))
+}
@@ -0,0 +1,93 @@
+package logwatch
+
+import (
+	"time"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/log-file-metric-exporter/pkg/position"
+)
+
+// retiredRetention is how long rotation and loss counters are kept after the last file of a container is gone,
+// so their final values are scraped.
+const retiredRetention = 5 * time.Minute
+
+// readPositions reads the collector positions, returns nil if there is no position reader.
+// Files that can't be read are logged, counted and skipped.
+func (w *Watcher) readPositions() []position.Position {
+	if w.positions == nil {
+		return nil
+	}
+	positions, err := w.positions.Read()
+	for _, err := range position.Errors(err) {
+		log.Error(err, "error reading collector positions")
+		w.self.positionErrs.Inc()
+	}
+	return positions
+}
+
+// updatePositions records the collector position of each tracked file, and returns the files the positions reference.
+// Files are matched by inode, and by device if the collector records it.
+// Must be called with the mutex locked.
+func (w *Watcher) updatePositions(positions []position.Position) map[FileID]bool {
+	if len(positions) == 0 {
+		return nil
+	}
+	byInode := make(map[uint64][]*fileState, len(w.files.files))
+	for id, f := range w.files.files {
+		byInode[id.Inode] = append(byInode[id.Inode], f)
+	}
+	referenced := make(map[FileID]bool)
+	for _, p := range positions {
+		for _, f := range byInode[p.Inode] {
+			if p.Dev == 0 || p.Dev == f.id.Dev {
+				f.collected = max(f.collected, p.Offset)
+				referenced[f.id] = true
+			}
+		}
+	}
+	return referenced
+}
+
+// deleted is called when the state of a file is deleted, last is true if it was the last file of its container.
+// referenced are the files referenced by the collector positions read just before the deletion, nil if none were read.
+//
+// Bytes the collector had not read are counted as lost only if its positions still reference the file.
+// Collectors drop the position of a file they are done with, e.g. fluentd when the file is rotated, or mark it as
+// unwatched once fully read, so the loss of a file they no longer reference is unknown.
+// Must be called with the mutex locked.
+func (w *Watcher) deleted(f *fileState, last bool, referenced map[FileID]bool) {
+	if w.lost != nil && referenced[f.id] && f.size > f.collected {
+		log.V(3).Info("file deleted before it was collected", "path", f.path, "size", f.size, "collected", f.collected)
+		w.lost.WithLabelValues(w.seriesLabels(f.labels).values()...).Add(float64(f.size - f.collected))
+	}
+	if last {
+		w.deleteSeries(f.labels)
+	}
+}
+
+// rotated counts a rotation of a log file, l are the series labels. Must be called with the mutex locked.
+func (w *Watcher) rotated(l LogLabels) {
+	w.rotations.WithLabelValues(l.values()...).Inc()
+	delete(w.retired, l)
+}
+
+// expireRetired deletes rotation and loss counters of containers, and aggregated series,
+// that have been gone for retiredRetention.
+// Must be called with the mutex locked.
+func (w *Watcher) expireRetired(now time.Time) {
+	for _, a := range w.aggregates() {
+		a.expire(now)
+	}
+	for l, t := range w.retired {
+		if now.Sub(t) > retiredRetention {
+			delete(w.retired, l)
+			if w.files.series[l] > 0 || (l == overflowLabels && len(w.overflowed) > 0) {
+				continue // Container is back
+			}
+			w.rotations.DeleteLabelValues(l.values()...)
+			if w.lost != nil {
+				w.lost.DeleteLabelValues(l.values()...)
+			}
+		}
+	}
+}
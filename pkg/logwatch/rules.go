@@ -0,0 +1,102 @@
+package logwatch
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// labelGroups are the capture group names that can be used in a Rule pattern.
+var labelGroups = map[string]bool{"namespace": true, "podname": true, "poduuid": true, "containername": true}
+
+// Rule extracts LogLabels from a log file path.
+//
+// Pattern is a regular expression matched against the path, with named capture groups for the labels:
+// "namespace", "podname", "poduuid" and "containername". Labels without a group are empty.
+type Rule struct {
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+}
+
+// Rules are tried in order, the first matching rule sets the labels.
+type Rules []Rule
+
+// DefaultRules match the Pod log files written by kubelet under /var/log/pods:
+//
+//	/var/log/pods/<namespace>_<podname>_<poduuid>/<containername>/<n>.log
+//
+// and their rotated copies "<n>.log.<timestamp>".
+// Compressed rotated files are not matched, they were already counted before compression.
+var DefaultRules = MustCompileRules(
+	`/(?P<namespace>[a-z0-9-]+)_(?P<podname>[a-z0-9-]+)_(?P<poduuid>[a-f0-9-]+)/(?P<containername>[a-z0-9-]+)/[^/]*\.log(\.[0-9]{8}-[0-9]{6})?$`,
+)
+
+// CompileRules returns validated rules for patterns.
+func CompileRules(patterns ...string) (Rules, error) {
+	rules := make(Rules, len(patterns))
+	for i, p := range patterns {
+		rules[i].Pattern = p
+	}
+	return rules, rules.Compile()
+}
+
+// MustCompileRules is like CompileRules but panics on error.
+func MustCompileRules(patterns ...string) Rules {
+	rules, err := CompileRules(patterns...)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// Compile and validate the rule patterns. Rules must be compiled before they are used.
+func (rs Rules) Compile() error {
+	if len(rs) == 0 {
+		return fmt.Errorf("no label rules")
+	}
+	for i := range rs {
+		re, err := regexp.Compile(rs[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid label rule %q: %w", rs[i].Pattern, err)
+		}
+		named := 0
+		for _, name := range re.SubexpNames() {
+			switch {
+			case name == "":
+			case labelGroups[name]:
+				named++
+			default:
+				return fmt.Errorf("invalid label rule %q: unknown label %q", rs[i].Pattern, name)
+			}
+		}
+		if named == 0 {
+			return fmt.Errorf("invalid label rule %q: no named groups for labels", rs[i].Pattern)
+		}
+		rs[i].re = re
+	}
+	return nil
+}
+
+// Parse sets l from the first rule matching path. Returns false if no rule matches.
+func (rs Rules) Parse(path string, l *LogLabels) bool {
+	for _, r := range rs {
+		match := r.re.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+		*l = LogLabels{}
+		for i, name := range r.re.SubexpNames() {
+			switch name {
+			case "namespace":
+				l.Namespace = match[i]
+			case "podname":
+				l.Name = match[i]
+			case "poduuid":
+				l.UUID = match[i]
+			case "containername":
+				l.Container = match[i]
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package logwatch
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SelfMetricPrefix is the prefix of the metrics about the exporter itself.
+const SelfMetricPrefix = "log_file_metric_exporter_"
+
+// watchCounter is implemented by event sources that can report the number of watches they hold.
+type watchCounter interface {
+	Watches() int
+}
+
+// selfMetrics are metrics about the watcher itself, labeled with the watch dir.
+type selfMetrics struct {
+	events       *prometheus.CounterVec
+	latency      prometheus.Histogram
+	updateErrors *prometheus.CounterVec
+	walkDuration prometheus.Gauge
+	reconciles   prometheus.Counter
+	coalesced    prometheus.Counter
+	positionErrs prometheus.Counter
+}
+
+// newSelfMetrics creates the self metrics of w, and returns them with the collectors to register.
+func newSelfMetrics(w *Watcher) (*selfMetrics, []prometheus.Collector) {
+	labels := prometheus.Labels{"dir": w.dir}
+	m := &selfMetrics{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        SelfMetricPrefix + "events_total",
+			Help:        "Total number of file events received, by operation",
+			ConstLabels: labels,
+		}, []string{"op"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        SelfMetricPrefix + "event_processing_seconds",
+			Help:        "Time to process the events of a file",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 8), // 100µs to 1.6s
+		}),
+		updateErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        SelfMetricPrefix + "update_errors_total",
+			Help:        "Total number of errors updating the metrics of a file, by reason: permission, or the failed operation",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+		walkDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        SelfMetricPrefix + "initial_walk_duration_seconds",
+			Help:        "Time to walk the watch dir when the exporter started",
+			ConstLabels: labels,
+		}),
+		reconciles: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        SelfMetricPrefix + "reconciles_total",
+			Help:        "Total number of walks of the watch dir to recover from missed events",
+			ConstLabels: labels,
+		}),
+		coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        SelfMetricPrefix + "events_coalesced_total",
+			Help:        "Total number of file events merged with a pending event for the same path",
+			ConstLabels: labels,
+		}),
+		positionErrs: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        SelfMetricPrefix + "position_read_errors_total",
+			Help:        "Total number of errors reading a log collector position file, the file is skipped",
+			ConstLabels: labels,
+		}),
+	}
+	collectors := []prometheus.Collector{m.events, m.latency, m.updateErrors, m.walkDuration, m.reconciles, m.coalesced, m.positionErrs,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        SelfMetricPrefix + "event_queue_depth",
+			Help:        "Number of paths with file events waiting to be processed",
+			ConstLabels: labels,
+		}, func() float64 { return float64(w.queue.len()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        SelfMetricPrefix + "files_tracked",
+			Help:        "Number of log files tracked",
+			ConstLabels: labels,
+		}, func() float64 {
+			w.mutex.RLock()
+			defer w.mutex.RUnlock()
+			return float64(len(w.files.files))
+		}),
+	}
+	if wc, ok := w.watcher.(watchCounter); ok {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        SelfMetricPrefix + "watches",
+			Help:        "Number of inotify watches, or fanotify marks, held by the watcher",
+			ConstLabels: labels,
+		}, func() float64 { return float64(wc.Watches()) }))
+	}
+	return m, collectors
+}
+
+// received counts an event.
+func (m *selfMetrics) received(e fsnotify.Event) {
+	m.events.WithLabelValues(strings.ToLower(e.Op.String())).Inc()
+}
+
+// processed observes the time since start to process an event.
+func (m *selfMetrics) processed(start time.Time) {
+	m.latency.Observe(time.Since(start).Seconds())
+}
+
+// updateFailed counts an Update error.
+func (m *selfMetrics) updateFailed(err error) {
+	reason := "other"
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		reason = "permission"
+	case errors.As(err, &pathErr):
+		reason = pathErr.Op
+	}
+	m.updateErrors.WithLabelValues(reason).Inc()
+}
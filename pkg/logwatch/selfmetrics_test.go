@@ -0,0 +1,49 @@
+package logwatch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	w, events, dir := setupFake(t, Options{MetricPrefix: "self_"})
+	path := filepath.Join(dir, logname)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+	process(w, events, fsnotify.Event{Name: path, Op: fsnotify.Create}, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	require.NoError(t, w.reconcile())
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.self.events.WithLabelValues("create")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.self.events.WithLabelValues("write")))
+	latency := &dto.Metric{}
+	require.NoError(t, w.self.latency.Write(latency))
+	assert.Equal(t, uint64(2), latency.GetHistogram().GetSampleCount())
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.self.reconciles))
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, SelfMetricPrefix+"files_tracked", SelfMetricPrefix+"event_queue_depth")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Greater(t, testutil.ToFloat64(w.self.walkDuration), float64(0))
+
+	w.self.updateFailed(&fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission})
+	w.self.updateFailed(&fs.PathError{Op: "read", Path: path, Err: errors.New("I/O error")})
+	w.self.updateFailed(errors.New("other"))
+	for _, reason := range []string{"permission", "read", "other"} {
+		assert.Equal(t, float64(1), testutil.ToFloat64(w.self.updateErrors.WithLabelValues(reason)), reason)
+	}
+
+	// Metrics are removed with the watcher.
+	w.Close()
+	n, err = testutil.GatherAndCount(prometheus.DefaultGatherer, SelfMetricPrefix+"files_tracked")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
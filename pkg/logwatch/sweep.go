@@ -0,0 +1,113 @@
+package logwatch
+
+import (
+	"os"
+	"time"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+)
+
+// maxSweepInterval is the maximum interval between sweeps.
+const maxSweepInterval = time.Minute
+
+// sweepEvery sweeps until the watcher is closed.
+func (w *Watcher) sweepEvery(ttl time.Duration) {
+	ticker := time.NewTicker(min(ttl/2, maxSweepInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.sweep(now, ttl)
+		}
+	}
+}
+
+// sweep deletes the state of files that no longer exist, or have not changed for ttl,
+// in case their removal was missed, and the series of containers that have no files left.
+//
+// The offset of an unchanged file is kept, so it is not counted again if it changes later.
+func (w *Watcher) sweep(now time.Time, ttl time.Duration) {
+	type candidate struct {
+		f    *fileState
+		path string
+		size int64
+	}
+	var candidates []candidate
+	var swept []FileCheckpoint
+	w.mutex.RLock()
+	for _, f := range w.files.files {
+		if f.detached.IsZero() {
+			candidates = append(candidates, candidate{f: f, path: f.path, size: f.size})
+		}
+	}
+	for _, fc := range w.swept {
+		swept = append(swept, fc)
+	}
+	w.mutex.RUnlock()
+
+	// Stat files without the lock, the state is checked again before it is deleted.
+	var gone, idle []candidate
+	for _, c := range candidates {
+		info, err := os.Stat(c.path)
+		switch {
+		case os.IsNotExist(err) || (err == nil && fileIDOf(info) != c.f.id):
+			gone = append(gone, c)
+		case err == nil && now.Sub(info.ModTime()) > ttl && info.Size() == c.size:
+			idle = append(idle, c)
+		}
+	}
+	var sweptGone []FileCheckpoint
+	for _, fc := range swept {
+		if info, err := os.Stat(fc.Path); os.IsNotExist(err) || (err == nil && fileIDOf(info) != fc.FileID) {
+			sweptGone = append(sweptGone, fc)
+		}
+	}
+
+	positions := w.readPositions()
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	referenced := w.updatePositions(positions)
+	unchanged := func(c candidate) bool {
+		return w.files.files[c.f.id] == c.f && c.f.detached.IsZero() && c.f.path == c.path && c.f.size == c.size
+	}
+	for _, c := range gone {
+		if unchanged(c) {
+			log.V(3).Info("sweeping file that no longer exists", "path", c.path)
+			last := w.files.delete(c.f)
+			w.deleted(c.f, last, referenced)
+			w.reaped(last)
+		}
+	}
+	for _, c := range idle {
+		if unchanged(c) {
+			log.V(3).Info("sweeping unchanged file", "path", c.path, "ttl", ttl)
+			w.swept[c.f.id] = FileCheckpoint{Path: c.path, FileID: c.f.id, Offset: c.f.size, Head: c.f.scanner.head}
+			last := w.files.delete(c.f)
+			if last {
+				w.deleteSeries(c.f.labels)
+			}
+			w.reaped(last)
+		}
+	}
+	w.expire(referenced)
+	w.expireSwept(sweptGone)
+}
+
+// reaped counts the series of a container deleted by the sweeper, if it had no files left.
+func (w *Watcher) reaped(last bool) {
+	if last {
+		w.reapedSeries.Inc()
+	}
+}
+
+// expireSwept forgets the offsets of swept files found to no longer exist, unless they were swept again meanwhile.
+// Must be called with the mutex locked.
+func (w *Watcher) expireSwept(gone []FileCheckpoint) {
+	for _, fc := range gone {
+		if cur, ok := w.swept[fc.FileID]; ok && cur.Path == fc.Path && cur.Offset == fc.Offset {
+			delete(w.swept, fc.FileID)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package logwatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherSweep(t *testing.T) {
+	// Events are not sent, as if they were missed.
+	w, _, dir := setupFake(t, Options{MetricPrefix: "swept_"})
+	path := filepath.Join(dir, logname)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+	require.NoError(t, w.Update(path))
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	series := func() int { return testutil.CollectAndCount(w.metrics) }
+	require.Equal(t, 1, series())
+
+	// Recently changed files are kept.
+	w.sweep(time.Now(), time.Hour)
+	assert.Equal(t, 1, series())
+
+	// Unchanged files are swept, but not counted again when they change.
+	w.sweep(time.Now().Add(time.Hour), time.Minute)
+	assert.Equal(t, 0, series())
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.reapedSeries))
+
+	// Swept files are saved in checkpoints, and not brought back by walks while they are unchanged.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, []FileCheckpoint{{Path: path, FileID: fileIDOf(info), Offset: int64(len(data))}}, w.Checkpoint().Files)
+	require.NoError(t, w.reconcile())
+	assert.Empty(t, w.files.files)
+	w.sweep(time.Now().Add(time.Hour), time.Minute)
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.reapedSeries))
+
+	writeToFile(t, path)
+	require.NoError(t, w.Update(path))
+	assert.Equal(t, float64(len(data)), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)))
+
+	// Files that no longer exist are swept.
+	require.NoError(t, os.Remove(path))
+	w.sweep(time.Now(), time.Hour)
+	assert.Equal(t, 0, series())
+	assert.Equal(t, float64(2), testutil.ToFloat64(w.reapedSeries))
+	assert.Empty(t, w.files.files)
+	assert.Empty(t, w.swept)
+}
+
+func TestWatcherSweepWhileRenaming(t *testing.T) {
+	w, _, dir := setupFake(t, Options{MetricPrefix: "swept_renamed_"})
+	path := filepath.Join(dir, logname)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+	require.NoError(t, w.Update(path))
+
+	done := make(chan struct{})
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				w.sweep(time.Now(), time.Hour)
+			}
+		}
+	}()
+	// Rename the file back and forth, as log rotation would, while it is swept.
+	paths := []string{path, path + ".1"}
+	for i := 0; i < 100; i++ {
+		from, to := paths[i%2], paths[(i+1)%2]
+		require.NoError(t, os.Rename(from, to))
+		require.NoError(t, w.Update(to))
+	}
+	close(done)
+	<-swept
+	w.sweep(time.Now(), time.Hour)
+	assert.Len(t, w.files.files, 1)
+}
@@ -0,0 +1,46 @@
+package logwatch
+
+import (
+	"github.com/log-file-metric-exporter/pkg/position"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unreadCollector exports the bytes the log collector has not yet read, per container.
+// Collector positions are read on each scrape and compared with the sizes counted by the watcher,
+// position files that can't be read are skipped so they don't fail the scrape.
+type unreadCollector struct {
+	w    *Watcher
+	desc *prometheus.Desc
+}
+
+func newUnreadCollector(w *Watcher, prefix string) *unreadCollector {
+	return &unreadCollector{
+		w: w,
+		desc: prometheus.NewDesc(prefix+"collector_unread_bytes",
+			"Number of bytes written to log files that have not yet been read by the log collector",
+			[]string{"namespace", "podname", "poduuid", "containername"}, nil),
+	}
+}
+
+func (c *unreadCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+func (c *unreadCollector) Collect(ch chan<- prometheus.Metric) {
+	for l, v := range c.w.unread(c.w.readPositions()) {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, v, l.values()...)
+	}
+}
+
+// unread updates the collector positions of tracked files, and returns the bytes not yet read
+// for each container with a file the collector is reading.
+func (w *Watcher) unread(positions []position.Position) map[LogLabels]float64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.updatePositions(positions)
+	unread := map[LogLabels]float64{}
+	for _, f := range w.files.files {
+		if f.collected >= 0 {
+			unread[w.seriesLabels(f.labels)] += float64(max(0, f.size-f.collected))
+		}
+	}
+	return unread
+}
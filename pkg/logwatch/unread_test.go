@@ -0,0 +1,115 @@
+package logwatch
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/log-file-metric-exporter/pkg/position"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePositions struct {
+	mutex     sync.Mutex
+	positions []position.Position
+	err       error // Error of files that could not be read.
+}
+
+func (p *fakePositions) Read() ([]position.Position, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.positions, p.err
+}
+
+func (p *fakePositions) set(positions ...position.Position) []position.Position {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.positions = positions
+	return positions
+}
+
+func TestUnreadBytes(t *testing.T) {
+	positions := &fakePositions{}
+	w, path, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data+data+data), 0600)) },
+		func(string) Options { return Options{Positions: positions} })
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	id := fileIDOf(info)
+	assert.Empty(t, w.unread(nil), "collector is not reading the file")
+	p := positions.set(
+		position.Position{Inode: id.Inode, Offset: int64(len(data))},
+		position.Position{Inode: id.Inode + 1, Offset: 1}, // Unknown file
+	)
+	assert.Equal(t, map[LogLabels]float64{l: float64(2 * len(data))}, w.unread(p))
+
+	// Device must match if known.
+	p = positions.set(position.Position{Dev: id.Dev + 1, Inode: id.Inode, Offset: int64(3 * len(data))})
+	assert.Equal(t, map[LogLabels]float64{l: float64(2 * len(data))}, w.unread(p))
+	p = positions.set(position.Position{Dev: id.Dev, Inode: id.Inode, Offset: int64(2 * len(data))})
+	assert.Equal(t, map[LogLabels]float64{l: float64(len(data))}, w.unread(p))
+
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "log_collector_unread_bytes")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestUnreadBytesPositionErrors(t *testing.T) {
+	positions := &fakePositions{}
+	w, path, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data+data), 0600)) },
+		func(string) Options { return Options{MetricPrefix: "position_errors_", Positions: positions} })
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	positions.set(position.Position{Inode: fileIDOf(info).Inode, Offset: int64(len(data))})
+	positions.mutex.Lock()
+	positions.err = errors.Join(errors.New("invalid fluentd pos_file line"), errors.New("unsupported vector checkpoints version"))
+	positions.mutex.Unlock()
+
+	// A bad position file doesn't fail the scrape, the other positions are used.
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "position_errors_collector_unread_bytes", "position_errors_logged_bytes_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, map[LogLabels]float64{l: float64(len(data))}, w.unread(w.readPositions()))
+	assert.Equal(t, float64(4), testutil.ToFloat64(w.self.positionErrs))
+}
+
+func TestRotatedUnreadBytes(t *testing.T) {
+	positions := &fakePositions{}
+	w, path, l := setupWithOptions(t,
+		func(path string) { require.NoError(t, os.WriteFile(path, []byte(data+data), 0600)) },
+		func(string) Options { return Options{Positions: positions} })
+	lost := func() float64 { return testutil.ToFloat64(w.lost.WithLabelValues(l.values()...)) }
+	rotate := func(suffix string) (rotated string, inode uint64) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		rotated = path + suffix
+		require.NoError(t, os.Rename(path, rotated))
+		require.NoError(t, w.Update(rotated))
+		require.NoError(t, os.WriteFile(path, []byte(data+data), 0600))
+		require.NoError(t, w.Update(path))
+		return rotated, fileIDOf(info).Inode
+	}
+
+	// The collector still reads the rotated file when it is deleted, the bytes it had not read are lost.
+	rotated, inode := rotate(".20261018-120000")
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.rotations.WithLabelValues(l.values()...)))
+	w.unread(positions.set(position.Position{Inode: inode, Offset: int64(len(data))}))
+	require.NoError(t, os.Remove(rotated))
+	w.Forget(rotated)
+	assert.Equal(t, float64(len(data)), lost())
+
+	// The collector forgot the rotated file before it was deleted, e.g. because it finished reading it,
+	// the loss at its last known position is unknown and not counted.
+	rotated, inode = rotate(".20261018-130000")
+	w.unread(positions.set(position.Position{Inode: inode, Offset: int64(len(data))}))
+	positions.set()
+	require.NoError(t, os.Remove(rotated))
+	w.Forget(rotated)
+	assert.Equal(t, float64(len(data)), lost())
+}
@@ -2,21 +2,25 @@
 package logwatch
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/ViaQ/logerr/v2/log/static"
 	"github.com/fsnotify/fsnotify"
+	"github.com/log-file-metric-exporter/pkg/fanotify"
+	"github.com/log-file-metric-exporter/pkg/pollnotify"
+	"github.com/log-file-metric-exporter/pkg/position"
 	"github.com/log-file-metric-exporter/pkg/symnotify"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var logFile = regexp.MustCompile(`/([a-z0-9-]+)_([a-z0-9-]+)_([a-f0-9-]+)/([a-z0-9-]+)/.*\.log`)
-
 // LogLabels are the labels for a Pod log file.
 //
 // NOTE: The log Path is not a label because it includes a variable "n.log" part that changes
@@ -25,97 +29,458 @@ type LogLabels struct {
 	Namespace, Name, UUID, Container string
 }
 
+// labels returns the metric labels identifying the container.
+func (l LogLabels) labels() prometheus.Labels {
+	return prometheus.Labels{"namespace": l.Namespace, "podname": l.Name, "poduuid": l.UUID, "containername": l.Container}
+}
+
+// values returns the metric label values for the container.
+func (l LogLabels) values() []string {
+	return []string{l.Namespace, l.Name, l.UUID, l.Container}
+}
+
+// streamValues returns the metric label values for a stream of the container.
+func (l LogLabels) streamValues(s Stream) []string {
+	return append(l.values(), s.String())
+}
+
+// Parse sets the labels from a Pod log file path using DefaultRules.
 func (l *LogLabels) Parse(path string) (ok bool) {
-	match := logFile.FindStringSubmatch(path)
-	if match != nil {
-		l.Namespace, l.Name, l.UUID, l.Container = match[1], match[2], match[3], match[4]
-		return true
-	}
-	return false
+	return DefaultRules.Parse(path, l)
+}
+
+// DefaultMetricPrefix is the prefix of the watcher metric names, e.g. log_logged_bytes_total.
+const DefaultMetricPrefix = "log_"
+
+// Options configure a Watcher.
+type Options struct {
+	// MetricPrefix is the prefix of the metric names, DefaultMetricPrefix if empty.
+	// Watchers registered at the same time must have different prefixes.
+	MetricPrefix string
+	// PollInterval is the interval between polls of the watch dir for changes if not 0,
+	// for file systems that do not support inotify. Otherwise inotify is used.
+	PollInterval time.Duration
+	// Fanotify watches the file system of the watch dir with a single fanotify mark instead of an inotify watch
+	// per directory, if PollInterval is 0. Falls back to inotify if fanotify is not available.
+	Fanotify bool
+	// Workers is the number of goroutines processing events, DefaultWorkers if 0.
+	Workers int
+	// CoalesceDelay is the minimum time between the first event for a path and its processing.
+	// Events for the path within the delay are merged, so a busy file is read once per delay instead of once per write.
+	CoalesceDelay time.Duration
+	// Events is the source of file system events if not nil, instead of inotify or polling.
+	// It is closed when the watcher is closed.
+	Events EventSource
+	// Checkpoint is the saved state of a previous watcher to resume from, may be nil.
+	Checkpoint *Checkpoint
+	// Rules extract labels from log file paths, DefaultRules if empty. Must be compiled.
+	Rules Rules
+	// Filter selects the containers to watch, all containers if nil. Must be compiled.
+	Filter *Filter
+	// MaxSeries is the maximum number of containers with their own series, unlimited if 0.
+	// Files of containers beyond the limit are counted in a series with all labels set to "__overflow__".
+	MaxSeries int
+	// ReconcileInterval is the interval between walks of the watch dir that recover from missed events,
+	// disabled if 0. The watch dir is also walked when the event queue overflows.
+	ReconcileInterval time.Duration
+	// SeriesTTL enables a sweeper that deletes the state of files that no longer exist, or have not changed for SeriesTTL,
+	// and the series of containers that have no files left. It is disabled if 0.
+	// This recovers from missed file removal events.
+	SeriesTTL time.Duration
+	// Aggregate enables the namespace_logged_bytes_total metric, and the workload_logged_bytes_total metric
+	// if the Enricher is a WorkloadResolver. They sum the logged bytes of all containers by namespace and by workload.
+	Aggregate bool
+	// Enricher adds labels to the logged bytes, lines and records metrics, may be nil.
+	// The series of a container are split if its enricher label values change.
+	Enricher Enricher
+	// Positions reads the log collector positions, enables the collector_unread_bytes
+	// and rotated_unread_bytes_total metrics if not nil.
+	Positions position.Reader
 }
 
+// EventSource is a file system watcher, such as symnotify.Watcher or pollnotify.Watcher.
+type EventSource interface {
+	// Add a directory tree, file or symlink to be watched.
+	Add(name string) error
+	// Remove name from the watched paths.
+	Remove(name string) error
+	// Event returns the next event or an error, io.EOF if the source is closed.
+	Event() (fsnotify.Event, error)
+	// Close stops watching.
+	Close() error
+}
+
+var (
+	_ EventSource = &symnotify.Watcher{}
+	_ EventSource = &pollnotify.Watcher{}
+	_ EventSource = &fanotify.Watcher{}
+)
+
 type Watcher struct {
-	watcher *symnotify.Watcher
-	metrics *prometheus.CounterVec
-	sizes   map[LogLabels]float64
-	mutex   sync.RWMutex
+	dir            string
+	watcher        EventSource
+	metrics        *prometheus.CounterVec
+	lines          *prometheus.CounterVec
+	records        *prometheus.CounterVec
+	rotations      *prometheus.CounterVec
+	dropped        prometheus.Counter
+	reapedSeries   prometheus.Counter
+	lost           *prometheus.CounterVec // Nil if there are no collector positions.
+	namespaceBytes *aggregate             // Nil if aggregation is disabled.
+	workloadBytes  *aggregate             // Nil if aggregation is disabled or there is no WorkloadResolver.
+	registered     []prometheus.Collector // Registered collectors, unregistered on close.
+	positions      position.Reader
+	enricher       Enricher
+	rules          Rules
+	filter         *Filter
+	maxSeries      int
+	overflowed     map[LogLabels]bool // Containers counted in the overflow series.
+	files          fileTable
+	retired        map[LogLabels]time.Time   // Containers with no files left, by time of the last file removal.
+	restored       map[FileID]FileCheckpoint // Checkpoint entries, used during the initial walk.
+	swept          map[FileID]FileCheckpoint // Offsets of unchanged files deleted by the sweeper.
+	done           chan struct{}             // Closed when the watcher is closed.
+	closeOnce      sync.Once
+	reconciles     chan struct{} // Pending request to reconcile, e.g. after an event queue overflow.
+	queue          *eventQueue
+	watching       atomic.Bool // Watch is running.
+	self           *selfMetrics
+	workers        int
+	mutex          sync.RWMutex
 }
 
-func New(dir string) (*Watcher, error) {
+func New(dir string, opts Options) (*Watcher, error) {
 	log.V(3).Info("Initializing a new watcher...")
 	//Get new watcher
-	watcher, err := symnotify.NewWatcher()
+	watcher := opts.Events
+	var err error
+	switch {
+	case watcher != nil:
+	case opts.PollInterval > 0:
+		watcher, err = pollnotify.NewWatcher(opts.PollInterval)
+	case opts.Fanotify:
+		if watcher, err = newFanotify(dir); err != nil {
+			log.Error(err, "fanotify is not available, using inotify", "dir", dir)
+			watcher, err = symnotify.NewWatcher()
+		}
+	default:
+		watcher, err = symnotify.NewWatcher()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error creating watcher: %w", err)
 	}
+	prefix := opts.MetricPrefix
+	if prefix == "" {
+		prefix = DefaultMetricPrefix
+	}
+	labelNames := []string{"namespace", "podname", "poduuid", "containername"}
+	var streamLabelNames []string
+	streamLabelNames = append(streamLabelNames, labelNames...)
+	if opts.Enricher != nil {
+		streamLabelNames = append(streamLabelNames, opts.Enricher.LabelNames()...)
+	}
+	streamLabelNames = append(streamLabelNames, "stream")
 	w := &Watcher{
+		dir:     dir,
 		watcher: watcher,
 		metrics: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name: "log_logged_bytes_total",
-			Help: "Total number of bytes written to a single log file path, accounting for rotations",
-		}, []string{"namespace", "podname", "poduuid", "containername"}),
-		sizes: make(map[LogLabels]float64),
-		mutex: sync.RWMutex{},
+			Name: prefix + "logged_bytes_total",
+			Help: "Total number of bytes written to a single log file path, accounting for rotations, by CRI stream",
+		}, streamLabelNames),
+		lines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "logged_lines_total",
+			Help: "Total number of lines written to a single log file path, accounting for rotations, by CRI stream",
+		}, streamLabelNames),
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "logged_records_total",
+			Help: "Total number of log records written to a single log file path, CRI partial lines are joined into a single record",
+		}, streamLabelNames),
+		rotations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "file_rotations_total",
+			Help: "Total number of rotations of the log files of a container, by rename or truncation",
+		}, labelNames),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "exporter_series_dropped_total",
+			Help: "Total number of containers counted in the __overflow__ series because the series limit was reached",
+		}),
+		reapedSeries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "exporter_series_reaped_total",
+			Help: "Total number of containers whose series were deleted because their files no longer exist or did not change",
+		}),
+		positions:  opts.Positions,
+		enricher:   opts.Enricher,
+		rules:      opts.Rules,
+		filter:     opts.Filter,
+		maxSeries:  opts.MaxSeries,
+		overflowed: make(map[LogLabels]bool),
+		files:      newFileTable(),
+		retired:    make(map[LogLabels]time.Time),
+		restored:   make(map[FileID]FileCheckpoint),
+		swept:      make(map[FileID]FileCheckpoint),
+		done:       make(chan struct{}),
+		reconciles: make(chan struct{}, 1),
+		queue:      newEventQueue(opts.CoalesceDelay),
+		workers:    opts.Workers,
+		mutex:      sync.RWMutex{},
+	}
+	if len(w.rules) == 0 {
+		w.rules = DefaultRules
+	}
+	if w.workers <= 0 {
+		w.workers = DefaultWorkers
+	}
+	if opts.Checkpoint != nil {
+		for _, fc := range opts.Checkpoint.Files {
+			w.restored[fc.FileID] = fc
+		}
 	}
 
-	log.V(3).Info("Registering counter", "metrics", w.metrics)
-	if err := prometheus.Register(w.metrics); err != nil {
-		return nil, fmt.Errorf("error registering metrics: %w", err)
+	register := []prometheus.Collector{w.metrics, w.lines, w.records, w.rotations, w.dropped, w.reapedSeries}
+	var selfCollectors []prometheus.Collector
+	w.self, selfCollectors = newSelfMetrics(w)
+	register = append(register, selfCollectors...)
+	if opts.Aggregate {
+		w.namespaceBytes = newAggregate(prometheus.CounterOpts{
+			Name: prefix + "namespace_logged_bytes_total",
+			Help: "Total number of bytes written to the log files of all containers in a namespace",
+		}, []string{"namespace"})
+		register = append(register, w.namespaceBytes.vec)
+		if _, ok := opts.Enricher.(WorkloadResolver); ok {
+			w.workloadBytes = newAggregate(prometheus.CounterOpts{
+				Name: prefix + "workload_logged_bytes_total",
+				Help: "Total number of bytes written to the log files of all containers of a workload",
+			}, []string{"namespace", "owner_kind", "owner_name"})
+			register = append(register, w.workloadBytes.vec)
+		}
 	}
-	log.V(3).Info("Walking watch dir", "dir", dir)
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error { return w.Update(path) })
-	if err != nil {
+	if opts.Positions != nil {
+		w.lost = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "rotated_unread_bytes_total",
+			Help: "Total number of bytes in log files that were deleted before the log collector read them",
+		}, labelNames)
+		register = append(register, w.lost, newUnreadCollector(w, prefix))
+	}
+	for _, c := range register {
+		log.V(3).Info("Registering collector", "metrics", c)
+		if err := prometheus.Register(c); err != nil {
+			w.unregister()
+			return nil, fmt.Errorf("error registering metrics: %w", err)
+		}
+		w.registered = append(w.registered, c)
+	}
+	start := time.Now()
+	if err = w.walk(); err != nil {
 		return nil, err
 	}
+	w.self.walkDuration.Set(time.Since(start).Seconds())
+	w.mutex.Lock()
+	w.restored = nil // Only files present at start are restored.
+	w.mutex.Unlock()
 	err = w.watcher.Add(dir)
 	if err != nil {
 		return nil, fmt.Errorf("error watching directory %v: %w", dir, err)
 	}
+	go w.reconcileEvery(opts.ReconcileInterval)
+	if opts.SeriesTTL > 0 {
+		go w.sweepEvery(opts.SeriesTTL)
+	}
 	return w, nil
 }
 
+// newFanotify returns a fanotify watcher for dir, or an error if fanotify is not available.
+func newFanotify(dir string) (*fanotify.Watcher, error) {
+	watcher, err := fanotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Marking requires capabilities that are only checked when the mark is added.
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// walk the watch dir and update all files.
+func (w *Watcher) walk() error {
+	log.V(3).Info("Walking watch dir", "dir", w.dir)
+	return filepath.Walk(w.dir, func(path string, info os.FileInfo, err error) error { return w.Update(path) })
+}
+
+// SetFilter replaces the container filter, f must be compiled.
+// Files of containers that are no longer selected are forgotten,
+// and the watch dir is walked again to find files of containers that are now selected.
+func (w *Watcher) SetFilter(f *Filter) error {
+	w.mutex.Lock()
+	w.filter = f
+	for _, file := range w.files.files {
+		if !f.Allows(file.labels) {
+			log.V(3).Info("Forgetting filtered file", "path", file.path)
+			if w.files.delete(file) {
+				w.deleteSeries(file.labels)
+			}
+		}
+	}
+	w.mutex.Unlock()
+	return w.walk()
+}
+
+// Close stops watching and unregisters the metrics. It can be called more than once.
 func (w *Watcher) Close() {
-	w.watcher.Close()
-	prometheus.Unregister(w.metrics)
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.watcher.Close()
+		w.unregister()
+	})
+}
+
+func (w *Watcher) collectors() []*prometheus.CounterVec {
+	return []*prometheus.CounterVec{w.metrics, w.lines, w.records}
 }
 
+func (w *Watcher) unregister() {
+	for _, c := range w.registered {
+		prometheus.Unregister(c)
+	}
+	w.registered = nil
+}
+
+// Forget a removed file. The metrics for its container are deleted if it was the last file.
 func (w *Watcher) Forget(path string) {
 	log.V(3).Info("Watcher#Forget", "path", path)
-	var l LogLabels
-	if l.Parse(path) {
-		defer w.mutex.Unlock()
-		w.mutex.Lock()
-		delete(w.sizes, l) // Clean up sizes entry
-		_ = w.metrics.DeleteLabelValues(l.Namespace, l.Name, l.UUID, l.Container)
+	positions := w.readPositions() // Latest positions, to check if the file was fully collected.
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	referenced := w.updatePositions(positions)
+	if f, last := w.files.remove(path); f != nil {
+		w.deleted(f, last, referenced)
 	}
+	w.expire(referenced)
 }
 
-func (w *Watcher) Watch() error {
-	for {
-		max := 5
-		wg := sync.WaitGroup{}
-		wg.Add(max)
-		for i := 1; i <= max; i++ {
-			go w.processNextEvent(&wg)
+// detach a file that is no longer at path, it may have been renamed by log rotation.
+func (w *Watcher) detach(path string) {
+	log.V(3).Info("Watcher#detach", "path", path)
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	w.files.detach(path)
+	w.expire(nil)
+}
+
+// expire files that were detached and not seen again, must be called with the mutex locked.
+// referenced are the files referenced by the collector positions just read, if any, see deleted.
+func (w *Watcher) expire(referenced map[FileID]bool) {
+	now := time.Now()
+	w.files.expire(now, func(f *fileState, last bool) { w.deleted(f, last, referenced) })
+	w.expireRetired(now)
+}
+
+// deleteSeries deletes the metrics for a container that has no files left, must be called with the mutex locked.
+// Rotation and loss counters, and aggregated series left without containers, are retired, they are deleted later.
+// The overflow series is deleted when there are no containers left in it.
+func (w *Watcher) deleteSeries(l LogLabels) {
+	for _, a := range w.aggregates() {
+		a.remove(l)
+	}
+	if w.overflowed[l] {
+		delete(w.overflowed, l)
+		if len(w.overflowed) > 0 {
+			return
 		}
-		wg.Wait()
+		l = overflowLabels
+	}
+	for _, c := range w.collectors() {
+		_ = c.DeletePartialMatch(l.labels())
+	}
+	w.retired[l] = time.Now()
+}
+
+// Watch processes events until ctx is done or the watcher is closed, and returns nil.
+// Events are read into a queue that merges the events of each path, and processed by a pool of workers.
+// When ctx is done, events that were already read are processed before Watch returns.
+func (w *Watcher) Watch(ctx context.Context) error {
+	w.watching.Store(true)
+	defer w.watching.Store(false)
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				path, op, ok := w.queue.pop()
+				if !ok {
+					return
+				}
+				w.process(path, op)
+				w.queue.done(path)
+			}
+		}()
+	}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			e, err := w.watcher.Event()
+			switch {
+			case err == io.EOF:
+				return
+			case err != nil:
+				w.handleError(err)
+			default:
+				log.V(3).Info("logwatch.Watcher#Watch", "path", e.Name, "event", e.Op.String())
+				w.self.received(e)
+				if w.queue.push(e) {
+					w.self.coalesced.Inc()
+				}
+			}
+		}
+	}()
+	select {
+	case <-ctx.Done():
+		log.V(3).Info("processing queued events before stopping", "dir", w.dir, "queued", w.queue.len())
+		w.queue.closeAndDrain()
+	case <-closed:
+		w.queue.close()
 	}
+	wg.Wait()
 	return nil
 }
-func (w *Watcher) processNextEvent(wg *sync.WaitGroup) {
-	defer wg.Done()
-	e, err := w.watcher.Event()
-	log.V(3).Info("logwatch.Watcher#Watch", "path", e.Name, "event", e.Op.String())
+
+// Healthy returns an error if Watch is not running, or if the oldest queued event has waited
+// longer than deadline after its coalesce delay, which means the workers are stuck or falling behind.
+func (w *Watcher) Healthy(deadline time.Duration) error {
+	if !w.watching.Load() {
+		return errors.New("not watching")
+	}
+	if oldest := w.queue.oldest(); !oldest.IsZero() {
+		if waited := time.Since(oldest) - w.queue.delay; waited > deadline {
+			return fmt.Errorf("event queued for %v", waited.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// handleError handles an error returned by the event source.
+func (w *Watcher) handleError(err error) {
 	switch {
 	case err == io.EOF:
-		return
-	case err != nil:
-		log.Error(err, "Error retrieving watch event")
-	case e.Op == fsnotify.Remove:
-		w.Forget(e.Name)
+	case errors.Is(err, fsnotify.ErrEventOverflow):
+		log.Error(err, "Events were lost, reconciling watch dir", "dir", w.dir)
+		w.requestReconcile()
 	default:
-		if err = w.Update(e.Name); err != nil {
-			log.V(4).Error(err, "Error during Watcher#Update", "path", e.Name, "event", e.Op.String())
+		log.Error(err, "Error retrieving watch event")
+	}
+}
+
+// process the merged operations of path. A removed file is forgotten before a new file at the same path is updated.
+func (w *Watcher) process(path string, op fsnotify.Op) {
+	defer w.self.processed(time.Now())
+	if op.Has(fsnotify.Remove) {
+		w.Forget(path)
+	}
+	if op&^fsnotify.Remove != 0 {
+		if err := w.Update(path); err != nil {
+			log.V(4).Error(err, "Error during Watcher#Update", "path", path, "event", op.String())
 		}
 	}
 }
@@ -124,24 +489,26 @@ func (w *Watcher) Update(path string) (err error) {
 	log.V(3).Info("Watcher#Update", "path", path)
 	defer func() {
 		if os.IsNotExist(err) {
-			w.Forget(path)
+			w.detach(path)
 			err = nil // Not an error if a file disappears
 		}
 		if err != nil {
 			log.Error(err, "error updating metric", "path", path)
+			w.self.updateFailed(err)
 		}
 	}()
 
 	var l LogLabels
-	if !l.Parse(path) {
+	if !w.rules.Parse(path, &l) {
 		log.V(3).Info("Unable to parse path for LogLabels. returning early from update", "path", path)
 		return nil
 	}
-	counter, err := w.metrics.GetMetricWithLabelValues(l.Namespace, l.Name, l.UUID, l.Container)
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	stat, err := os.Stat(path)
+	defer file.Close()
+	stat, err := file.Stat()
 	if err != nil {
 		return err
 	}
@@ -149,20 +516,86 @@ func (w *Watcher) Update(path string) (err error) {
 		log.V(3).Info("Ignoring path given it is a directory", "path", path)
 		return nil // Ignore directories
 	}
+	f := w.track(path, fileIDOf(stat), stat.Size(), l)
+	if f == nil {
+		log.V(3).Info("Ignoring path excluded by filter, or unchanged since it was swept", "path", path)
+		return nil
+	}
+
+	// The file is read with its own lock rather than the watcher lock, so reading a large append
+	// does not hold up other files or scrapes. Stat again with the file locked, so the size is not
+	// older than the offset saved by a concurrent update of the file.
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if stat, err = file.Stat(); err != nil {
+		return err
+	}
+	lastSize, size := f.size, stat.Size()
+	log.V(3).Info("Stats", "path", path, "lastSize", lastSize, "size", size)
+	scanner := f.scanner.clone()
+	truncated := size < lastSize
+	if truncated {
+		// File truncated, starting over.
+		lastSize, scanner = 0, lineScanner{}
+	} else if size == lastSize {
+		return nil
+	}
+	// Read the new data to count lines.
+	offset, c, err := readRange(file, lastSize, size, &scanner)
+
 	defer w.mutex.Unlock()
 	w.mutex.Lock()
-	lastSize, size := w.sizes[l], float64(stat.Size())
-	log.V(3).Info("Stats", "path", path, "lastSize", lastSize, "size", size)
-	w.sizes[l] = size
-	var add float64
-	if size > lastSize {
-		// File has grown, add the difference to the counter.
-		add = size - lastSize
-	} else if size < lastSize {
-		// File truncated, starting over. Add the size.
-		add = size
-	}
-	log.V(3).Info("updated metric", "path", path, "lastsize", lastSize, "currentsize", size, "addedbytes", add)
-	counter.Add(add)
-	return nil
+	if w.files.files[f.id] != f {
+		return err // Forgotten while it was read, its series are deleted.
+	}
+	f.size, f.scanner = offset, scanner
+	container := f.labels // Labels of the container that created the file
+	l = w.seriesLabels(container)
+	if truncated {
+		f.collected = -1
+		w.rotated(l)
+	}
+	log.V(3).Info("updated metric", "path", path, "lastsize", lastSize, "currentsize", offset)
+	var total float64
+	for s, sc := range c {
+		if sc.bytes == 0 {
+			continue
+		}
+		total += sc.bytes
+		values := w.streamValues(l, Stream(s))
+		w.metrics.WithLabelValues(values...).Add(sc.bytes)
+		w.lines.WithLabelValues(values...).Add(sc.lines)
+		w.records.WithLabelValues(values...).Add(sc.records)
+	}
+	if total > 0 {
+		w.aggregate(container, total)
+	}
+	return err
+}
+
+// track returns the state of the file id at path, restoring its offset or creating series if it is new.
+// Returns nil if the container is excluded by the filter, or if the file was swept and has not changed since,
+// so that walks don't bring back the series of idle containers.
+func (w *Watcher) track(path string, id FileID, size int64, l LogLabels) *fileState {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	w.expire(nil)
+	if !w.filter.Allows(l) {
+		return nil
+	}
+	if fc, ok := w.swept[id]; ok && fc.Offset == size && w.sameContainer(fc.Path, l) {
+		return nil
+	}
+	f, isNew, renamed := w.files.attach(path, id, l, func(f *fileState, last bool) { w.deleted(f, last, nil) })
+	if isNew {
+		w.restore(f, size)
+		if w.files.series[l] == 1 {
+			w.admit(l)
+		}
+		delete(w.retired, w.seriesLabels(l))
+	}
+	if renamed {
+		w.rotated(w.seriesLabels(f.labels))
+	}
+	return f
 }
@@ -1,13 +1,19 @@
 package logwatch
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/log-file-metric-exporter/pkg/fakenotify"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,6 +27,10 @@ const (
 )
 
 func setup(t *testing.T, initLog func(string)) (watcher *Watcher, path string, labels LogLabels) {
+	return setupWithOptions(t, initLog, func(string) Options { return Options{} })
+}
+
+func setupWithOptions(t *testing.T, initLog func(string), opts func(path string) Options) (watcher *Watcher, path string, labels LogLabels) {
 	t.Helper()
 	dir, err := ioutil.TempDir("", t.Name())
 	require.NoError(t, err)
@@ -35,13 +45,41 @@ func setup(t *testing.T, initLog func(string)) (watcher *Watcher, path string, l
 	if initLog != nil {
 		initLog(path)
 	}
-	watcher, err = New(dir)
+	watcher, err = New(dir, opts(path))
 	require.NoError(t, err)
-	go watcher.Watch()
+	go watcher.Watch(context.Background())
 	t.Cleanup(func() { watcher.Close() })
 	return watcher, path, labels
 }
 
+// setupFake creates a watcher for a temporary dir with a fake event source.
+// Events are only processed by calling process, so tests are independent of file system notification timing.
+func setupFake(t *testing.T, opts Options) (watcher *Watcher, events *fakenotify.Watcher, dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	events = fakenotify.NewWatcher()
+	opts.Events = events
+	watcher, err := New(dir, opts)
+	require.NoError(t, err)
+	t.Cleanup(watcher.Close)
+	return watcher, events, dir
+}
+
+// process sends events to the fake event source and handles all pending events one by one,
+// without the queue and workers of Watch.
+func process(w *Watcher, events *fakenotify.Watcher, send ...fsnotify.Event) {
+	events.Send(send...)
+	for events.Pending() > 0 {
+		e, err := events.Event()
+		if err != nil {
+			w.handleError(err)
+			continue
+		}
+		w.self.received(e)
+		w.process(e.Name, e.Op)
+	}
+}
+
 func getCounterValue(c prometheus.Counter) float64 {
 	m := &dto.Metric{}
 	if err := c.Write(m); err != nil {
@@ -53,7 +91,7 @@ func getCounterValue(c prometheus.Counter) float64 {
 func TestWatcherSeesFileChange(t *testing.T) {
 	w, path, l := setup(t, nil)
 
-	counter, err := w.metrics.GetMetricWithLabelValues(l.Namespace, l.Name, l.UUID, l.Container)
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
 	require.NoError(t, err)
 
 	assert.Eventually(t,
@@ -66,7 +104,7 @@ func TestWatcherSeesFileChange(t *testing.T) {
 	assert.NoError(t, os.Remove(path))
 	assert.Eventually(t,
 		func() bool {
-			counter, err := w.metrics.GetMetricWithLabelValues(l.Namespace, l.Name, l.UUID, l.Container)
+			counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
 			require.NoError(t, err)
 			return getCounterValue(counter) == 0
 		},
@@ -78,7 +116,7 @@ func TestWatcherSeesAndWatchesExistingFiles(t *testing.T) {
 		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
 	})
 
-	counter, err := w.metrics.GetMetricWithLabelValues(l.Namespace, l.Name, l.UUID, l.Container)
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
 	require.NoError(t, err)
 	// assert we see the initial file size
 	assert.Eventually(t,
@@ -102,8 +140,198 @@ func TestWatcherSeesAndWatchesExistingFiles(t *testing.T) {
 }
 
 func writeToFile(t *testing.T, path string) {
+	t.Helper()
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
 	require.NoError(t, err)
 	_, err = f.Write([]byte(data))
 	require.NoError(t, err)
 }
+
+func TestWatcherCountsLinesAndRecords(t *testing.T) {
+	w, path, l := setup(t, nil)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	defer f.Close()
+	stdout := "2021-06-03T14:22:36.000000000+00:00 stdout P hello world\n2021-06-03T14:22:36.000000000+00:00 stdout F !\n"
+	_, err = f.WriteString(stdout)
+	require.NoError(t, err)
+	stdoutBytes, err := w.metrics.GetMetricWithLabelValues(l.streamValues(Stdout)...)
+	require.NoError(t, err)
+	stdoutLines, err := w.lines.GetMetricWithLabelValues(l.streamValues(Stdout)...)
+	require.NoError(t, err)
+	stdoutRecords, err := w.records.GetMetricWithLabelValues(l.streamValues(Stdout)...)
+	require.NoError(t, err)
+	assert.Eventually(t,
+		func() bool {
+			return getCounterValue(stdoutBytes) == float64(len(stdout)) && getCounterValue(stdoutLines) == 2 && getCounterValue(stdoutRecords) == 1
+		},
+		time.Second, time.Second/10, "bytes %v, lines %v, records %v", getCounterValue(stdoutBytes), getCounterValue(stdoutLines), getCounterValue(stdoutRecords))
+
+	// Unterminated lines are counted when they are complete.
+	stderr := "2021-06-03T14:22:37.000000000+00:00 stderr F no newline yet\n"
+	_, err = f.WriteString(stderr[:20])
+	require.NoError(t, err)
+	_, err = f.WriteString(stderr[20:])
+	require.NoError(t, err)
+	stderrBytes, err := w.metrics.GetMetricWithLabelValues(l.streamValues(Stderr)...)
+	require.NoError(t, err)
+	stderrLines, err := w.lines.GetMetricWithLabelValues(l.streamValues(Stderr)...)
+	require.NoError(t, err)
+	assert.Eventually(t,
+		func() bool {
+			return getCounterValue(stderrBytes) == float64(len(stderr)) && getCounterValue(stderrLines) == 1
+		},
+		time.Second, time.Second/10, "bytes %v, lines %v", getCounterValue(stderrBytes), getCounterValue(stderrLines))
+	assert.Equal(t, float64(len(stdout)), getCounterValue(stdoutBytes))
+}
+
+func TestWatcherCountsRotatedFilesOnce(t *testing.T) {
+	w, path, l := setup(t, func(path string) { writeToFile(t, path) })
+	counter, err := w.metrics.GetMetricWithLabelValues(l.streamValues(UnknownStream)...)
+	require.NoError(t, err)
+	assert.Equal(t, float64(len(data)), getCounterValue(counter))
+
+	// Rotate: rename the log and start a new one.
+	rotated := path + ".20261018-120000"
+	require.NoError(t, os.Rename(path, rotated))
+	writeToFile(t, path)
+	writeToFile(t, path)
+	// Restarted container writes to a new log file concurrently.
+	restarted := filepath.Join(filepath.Dir(path), "3.log")
+	writeToFile(t, restarted)
+	assert.Eventually(t,
+		func() bool { return float64(4*len(data)) == getCounterValue(counter) },
+		time.Second, time.Second/10, "%v != %v", 4*len(data), getCounterValue(counter))
+
+	// Compressed rotated files are not counted.
+	require.NoError(t, os.WriteFile(rotated+".gz", []byte(data), 0600))
+	require.NoError(t, os.Remove(rotated))
+	writeToFile(t, path)
+	assert.Eventually(t,
+		func() bool { return float64(5*len(data)) == getCounterValue(counter) },
+		time.Second, time.Second/10, "%v != %v", 5*len(data), getCounterValue(counter))
+	time.Sleep(time.Second / 10)
+	assert.Equal(t, float64(5*len(data)), getCounterValue(counter))
+}
+
+func TestWatcherMetricPrefix(t *testing.T) {
+	w, _, l := setupWithOptions(t, func(path string) { writeToFile(t, path) }, func(string) Options {
+		return Options{MetricPrefix: "other_"}
+	})
+	// A second watcher with the default prefix can be registered at the same time.
+	setup(t, nil)
+	n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "other_logged_bytes_total")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, float64(len(data)), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)))
+}
+
+func TestWatcherPoll(t *testing.T) {
+	w, path, l := setupWithOptions(t, nil, func(string) Options {
+		return Options{MetricPrefix: "polled_", PollInterval: time.Second / 20}
+	})
+	bytes := func() float64 { return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)) }
+	writeToFile(t, path)
+	assert.Eventually(t, func() bool { return bytes() == float64(len(data)) }, time.Second, time.Second/10)
+
+	require.NoError(t, os.Remove(path))
+	assert.Eventually(t, func() bool { return testutil.CollectAndCount(w.metrics) == 0 }, time.Second, time.Second/10)
+}
+
+func TestWatcherFakeEvents(t *testing.T) {
+	w, events, dir := setupFake(t, Options{MetricPrefix: "fake_"})
+	path := filepath.Join(dir, logname)
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	assert.True(t, events.Watched(dir))
+	bytes := func() float64 { return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)) }
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	writeToFile(t, path)
+	process(w, events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	assert.Equal(t, float64(len(data)), bytes())
+
+	// Rotation: the renamed file is not counted again, the new file is counted.
+	rotated := path + ".20240101-000000"
+	require.NoError(t, os.Rename(path, rotated))
+	writeToFile(t, path)
+	process(w, events,
+		fsnotify.Event{Name: path, Op: fsnotify.Rename},
+		fsnotify.Event{Name: rotated, Op: fsnotify.Create},
+		fsnotify.Event{Name: path, Op: fsnotify.Create},
+		fsnotify.Event{Name: path, Op: fsnotify.Write})
+	assert.Equal(t, float64(2*len(data)), bytes())
+	assert.Equal(t, float64(1), testutil.ToFloat64(w.rotations.WithLabelValues(l.values()...)))
+
+	// Series are deleted with the last file.
+	require.NoError(t, os.Remove(rotated))
+	process(w, events, fsnotify.Event{Name: rotated, Op: fsnotify.Remove})
+	assert.Equal(t, float64(2*len(data)), bytes())
+	require.NoError(t, os.Remove(path))
+	process(w, events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	assert.Equal(t, 0, testutil.CollectAndCount(w.metrics))
+}
+
+// Falls back to inotify if fanotify is not available, the results are the same.
+func TestWatcherFanotify(t *testing.T) {
+	w, path, l := setupWithOptions(t, nil, func(string) Options {
+		return Options{MetricPrefix: "fanotify_", Fanotify: true}
+	})
+	bytes := func() float64 { return testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(UnknownStream)...)) }
+	writeToFile(t, path)
+	assert.Eventually(t, func() bool { return bytes() == float64(len(data)) }, time.Second, time.Second/10)
+
+	require.NoError(t, os.Remove(path))
+	assert.Eventually(t, func() bool { return testutil.CollectAndCount(w.metrics) == 0 }, time.Second, time.Second/10)
+}
+
+// appendConcurrently appends lines to path while update is called by several goroutines,
+// and returns the number of bytes written.
+func appendConcurrently(t *testing.T, path string, update func()) int {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	require.NoError(t, err)
+	defer f.Close()
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					update()
+				}
+			}
+		}()
+	}
+	// Large appends take longer to read, so concurrent updates are more likely to overlap.
+	chunk := strings.Repeat("2021-06-03T14:22:36.000000000+00:00 stdout F hello\n", 2000)
+	for i := 0; i < 100; i++ {
+		_, err := f.WriteString(chunk)
+		require.NoError(t, err)
+	}
+	close(stop)
+	wg.Wait()
+	update()
+	return 100 * len(chunk)
+}
+
+func TestWatcherConcurrentUpdates(t *testing.T) {
+	w, _, dir := setupFake(t, Options{MetricPrefix: "concurrent_"})
+	path := filepath.Join(dir, logname)
+	var l LogLabels
+	require.True(t, l.Parse(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+
+	n := 0
+	for i := 0; i < 5; i++ { // Races are not detected every time.
+		n += appendConcurrently(t, path, func() { assert.NoError(t, w.Update(path)) })
+	}
+	assert.Equal(t, float64(n), testutil.ToFloat64(w.metrics.WithLabelValues(l.streamValues(Stdout)...)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(w.rotations.WithLabelValues(l.values()...)))
+}
@@ -0,0 +1,189 @@
+// Package pollnotify provides a file system watcher that polls for changes,
+// for file systems where inotify events are not delivered, such as NFS, FUSE or nested overlay mounts.
+//
+// It has the same methods and events as symnotify.Watcher, so it can be used in its place.
+// Changes are detected by comparing the identity (device and inode), size and modification time
+// of all files under the watched paths at each poll, following symlinks.
+package pollnotify
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+	"github.com/fsnotify/fsnotify"
+)
+
+type Event = fsnotify.Event
+
+// fileState is the state of a file used to detect changes.
+type fileState struct {
+	dev, ino uint64
+	size     int64
+	modTime  time.Time
+}
+
+func stateOf(info os.FileInfo) fileState {
+	s := fileState{size: info.Size(), modTime: info.ModTime()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		s.dev, s.ino = uint64(st.Dev), uint64(st.Ino)
+	}
+	return s
+}
+
+// Watcher polls watched paths and reports changes as events.
+type Watcher struct {
+	interval time.Duration
+	events   chan Event
+	done     chan struct{}
+	once     sync.Once
+	mutex    sync.Mutex
+	roots    map[string]bool
+	files    map[string]fileState // Last seen state of all files under the roots.
+}
+
+// NewWatcher returns a watcher that polls every interval.
+func NewWatcher(interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		interval: interval,
+		events:   make(chan Event, 1024),
+		done:     make(chan struct{}),
+		roots:    map[string]bool{},
+		files:    map[string]fileState{},
+	}
+	go w.run()
+	return w, nil
+}
+
+// Event returns the next event, io.EOF if the watcher is closed.
+func (w *Watcher) Event() (Event, error) {
+	select {
+	case e := <-w.events:
+		return e, nil
+	case <-w.done:
+		return Event{}, io.EOF
+	}
+}
+
+// Add a directory tree, file or symlink to be watched.
+// Existing files are recorded without events, like inotify only reports changes after a watch is added.
+func (w *Watcher) Add(name string) error {
+	log.V(3).Info("start polling", "path", name)
+	if _, err := os.Stat(name); err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.roots[name] {
+		return nil
+	}
+	w.roots[name] = true
+	w.scan(name, w.files)
+	return nil
+}
+
+// Remove name from the watched paths, if it was added.
+func (w *Watcher) Remove(name string) error {
+	log.V(3).Info("stop polling", "path", name)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.roots[name] {
+		return nil
+	}
+	delete(w.roots, name)
+	for path := range w.files {
+		if !w.watched(path) {
+			delete(w.files, path)
+		}
+	}
+	return nil
+}
+
+// Close stops polling, Event returns io.EOF.
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll scans the roots and sends events for the changes since the last poll.
+func (w *Watcher) poll() {
+	w.mutex.Lock()
+	files := make(map[string]fileState, len(w.files))
+	for root := range w.roots {
+		w.scan(root, files)
+	}
+	var events []Event
+	for path, old := range w.files {
+		if _, ok := files[path]; !ok {
+			events = append(events, Event{Name: path, Op: fsnotify.Remove})
+		} else if s := files[path]; s.dev != old.dev || s.ino != old.ino {
+			// Replaced, e.g. a new log file created after rotation.
+			events = append(events, Event{Name: path, Op: fsnotify.Create})
+		} else if s != old {
+			events = append(events, Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path := range files {
+		if _, ok := w.files[path]; !ok {
+			events = append(events, Event{Name: path, Op: fsnotify.Create})
+		}
+	}
+	w.files = files
+	w.mutex.Unlock()
+	for _, e := range events {
+		select {
+		case w.events <- e:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// scan records the state of all files under root in files, following symlinks.
+// Must be called with the mutex locked.
+func (w *Watcher) scan(root string, files map[string]fileState) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Removed while scanning, or not readable.
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := os.Stat(path) // Follow symlinks
+		if err != nil {
+			return nil
+		}
+		files[path] = stateOf(info)
+		return nil
+	})
+}
+
+// watched returns true if path is under a watched root. Must be called with the mutex locked.
+func (w *Watcher) watched(path string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if w.roots[dir] {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package pollnotify_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/log-file-metric-exporter/pkg/pollnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitFor reads events until want has been seen. Other events are ignored,
+// a poll may see intermediate states, e.g. a file that is created and not yet written.
+func waitFor(t *testing.T, w *pollnotify.Watcher, want ...pollnotify.Event) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for len(want) > 0 {
+		got := make(chan pollnotify.Event, 1)
+		go func() {
+			e, _ := w.Event()
+			got <- e
+		}()
+		select {
+		case e := <-got:
+			for i := range want {
+				if e == want[i] {
+					want = append(want[:i], want[i+1:]...)
+					break
+				}
+			}
+		case <-deadline:
+			require.Fail(t, "missing events", "%v", want)
+		}
+	}
+}
+
+func TestPollCreateWriteRotateRemove(t *testing.T) {
+	dir := t.TempDir()
+	w, err := pollnotify.NewWatcher(time.Millisecond * 10)
+	require.NoError(t, err)
+	defer w.Close()
+	existing := filepath.Join(dir, "existing")
+	require.NoError(t, os.WriteFile(existing, []byte("x"), 0600))
+	require.NoError(t, w.Add(dir))
+
+	sub := filepath.Join(dir, "pod", "container")
+	require.NoError(t, os.MkdirAll(sub, 0700))
+	log := filepath.Join(sub, "0.log")
+	require.NoError(t, os.WriteFile(log, []byte("hello\n"), 0600))
+	waitFor(t, w, pollnotify.Event{Name: log, Op: fsnotify.Create})
+
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("more\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	waitFor(t, w, pollnotify.Event{Name: log, Op: fsnotify.Write})
+
+	// Rotation: the old file is seen under its new name, and a new file replaces it.
+	rotated := log + ".20240101-000000"
+	require.NoError(t, os.Rename(log, rotated))
+	require.NoError(t, os.WriteFile(log, nil, 0600))
+	waitFor(t, w, pollnotify.Event{Name: log, Op: fsnotify.Create}, pollnotify.Event{Name: rotated, Op: fsnotify.Create})
+
+	require.NoError(t, os.Remove(rotated))
+	waitFor(t, w, pollnotify.Event{Name: rotated, Op: fsnotify.Remove})
+
+	require.NoError(t, w.Close())
+	_, err = w.Event()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPollSymlink(t *testing.T) {
+	dir, targets := t.TempDir(), t.TempDir()
+	w, err := pollnotify.NewWatcher(time.Millisecond * 10)
+	require.NoError(t, err)
+	defer w.Close()
+	target := filepath.Join(targets, "target")
+	require.NoError(t, os.WriteFile(target, nil, 0600))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(target, link))
+	require.NoError(t, w.Add(dir))
+
+	require.NoError(t, os.WriteFile(target, []byte("hello\n"), 0600))
+	waitFor(t, w, pollnotify.Event{Name: link, Op: fsnotify.Write})
+}
@@ -0,0 +1,55 @@
+package position
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unwatched is the position fluentd writes for a file it no longer follows.
+const unwatched = 0xffffffffffffffff
+
+// Fluentd reads fluentd in_tail pos_file files.
+//
+// Each line of a pos_file is: <path>\t<position as 16 hex digits>\t<inode as 16 hex digits>
+type Fluentd struct {
+	// Glob pattern matching the pos_file files.
+	Glob string
+}
+
+func (r Fluentd) Read() ([]Position, error) { return readGlob(r.Glob, readFluentd) }
+
+func readFluentd(path string) ([]Position, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var positions []Position
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid fluentd pos_file line %v:%v: %q", path, n, line)
+		}
+		offset, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fluentd position %v:%v: %w", path, n, err)
+		}
+		inode, err := strconv.ParseUint(fields[2], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fluentd inode %v:%v: %w", path, n, err)
+		}
+		if offset == unwatched {
+			continue
+		}
+		positions = append(positions, Position{Path: fields[0], Inode: inode, Offset: int64(offset)})
+	}
+	return positions, scanner.Err()
+}
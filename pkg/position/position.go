@@ -0,0 +1,77 @@
+// Package position reads the positions saved by log collectors for the files they read.
+package position
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// Position is the offset up to which a collector has read a file.
+type Position struct {
+	// Path of the file as seen by the collector, may be empty.
+	Path string
+	// Dev is the device of the file, 0 if the collector does not record it.
+	Dev uint64
+	// Inode of the file.
+	Inode uint64
+	// Offset up to which the file has been read.
+	Offset int64
+}
+
+// Reader reads the current collector positions.
+type Reader interface {
+	// Read returns the positions of the files that could be read. A file that can't be read doesn't prevent
+	// reading the others, the errors are joined, see Errors.
+	Read() ([]Position, error)
+}
+
+// Readers combines the positions of several readers.
+type Readers []Reader
+
+func (rs Readers) Read() ([]Position, error) {
+	var all []Position
+	var errs []error
+	for _, r := range rs {
+		p, err := r.Read()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		all = append(all, p...)
+	}
+	return all, errors.Join(errs...)
+}
+
+// Errors returns the errors joined in an error returned by Read, one per file that could not be read.
+func Errors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, Errors(e)...)
+	}
+	return errs
+}
+
+// readGlob calls read for each file matching pattern and combines the results, skipping files that can't be read.
+func readGlob(pattern string, read func(path string) ([]Position, error)) ([]Position, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var all []Position
+	var errs []error
+	for _, path := range paths {
+		p, err := read(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		all = append(all, p...)
+	}
+	return all, errors.Join(errs...)
+}
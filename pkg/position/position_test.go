@@ -0,0 +1,71 @@
+package position
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFluentd(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "es-containers.log.pos"), []byte(
+		"/var/log/pods/ns_pod_1234/c/0.log\t0000000000000123\t0000000000abcdef\n"+
+			"/var/log/pods/ns_pod_1234/c/1.log\tffffffffffffffff\t0000000000abcdee\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.log.pos"), []byte(
+		"/var/log/audit/audit.log\t0000000000000010\t0000000000000002\n"), 0600))
+
+	got, err := Fluentd{Glob: filepath.Join(dir, "*.pos")}.Read()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Position{
+		{Path: "/var/log/pods/ns_pod_1234/c/0.log", Inode: 0xabcdef, Offset: 0x123},
+		{Path: "/var/log/audit/audit.log", Inode: 2, Offset: 0x10},
+	}, got)
+
+	// Files that can't be read are skipped.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.pos"), []byte("x\ty\n"), 0600))
+	got, err = Fluentd{Glob: filepath.Join(dir, "*.pos")}.Read()
+	assert.ErrorContains(t, err, "bad.pos")
+	assert.Len(t, Errors(err), 1)
+	assert.Len(t, got, 2)
+}
+
+func TestVector(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "input_a"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "input_a", "checkpoints.json"), []byte(`{
+  "version": "1",
+  "checkpoints": [
+    {"fingerprint": {"dev_inode": [2049, 1234]}, "position": 100, "modified": "2026-10-18T12:00:00Z"},
+    {"fingerprint": {"first_lines_checksum": 42}, "position": 5, "modified": "2026-10-18T12:00:00Z"}
+  ]
+}`), 0600))
+
+	got, err := Vector{Glob: filepath.Join(dir, "*", "checkpoints.json")}.Read()
+	require.NoError(t, err)
+	assert.Equal(t, []Position{{Dev: 2049, Inode: 1234, Offset: 100}}, got)
+	_, warned := skippedFiles.Load(filepath.Join(dir, "input_a", "checkpoints.json"))
+	assert.True(t, warned)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "input_a", "checkpoints.json"), []byte(`{"version": "2"}`), 0600))
+	_, err = Vector{Glob: filepath.Join(dir, "*", "checkpoints.json")}.Read()
+	assert.Error(t, err)
+}
+
+func TestReaders(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.pos"), []byte("/a\t0000000000000001\t0000000000000001\n"), 0600))
+	got, err := Readers{Fluentd{Glob: filepath.Join(dir, "*.pos")}, Vector{Glob: filepath.Join(dir, "none")}}.Read()
+	require.NoError(t, err)
+	assert.Equal(t, []Position{{Path: "/a", Inode: 1, Offset: 1}}, got)
+
+	// A broken fluentd file doesn't hide the positions of the other readers.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.pos"), []byte("invalid\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "checkpoints.json"), []byte(`{"version": "1", "checkpoints": [{"fingerprint": {"dev_inode": [1, 2]}, "position": 3}]}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v2.json"), []byte(`{"version": "2"}`), 0600))
+	got, err = Readers{Fluentd{Glob: filepath.Join(dir, "*.pos")}, Vector{Glob: filepath.Join(dir, "*.json")}}.Read()
+	assert.Len(t, Errors(err), 2)
+	assert.ElementsMatch(t, []Position{{Path: "/a", Inode: 1, Offset: 1}, {Dev: 1, Inode: 2, Offset: 3}}, got)
+}
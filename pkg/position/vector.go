@@ -0,0 +1,65 @@
+package position
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/ViaQ/logerr/v2/log/static"
+)
+
+// Vector reads the checkpoints.json files of Vector file and kubernetes_logs sources.
+//
+// Only checkpoints using the "device_and_inode" fingerprint strategy identify a file,
+// checksum fingerprints are skipped.
+type Vector struct {
+	// Glob pattern matching the checkpoints.json files, e.g. /var/lib/vector/*/checkpoints.json
+	Glob string
+}
+
+type vectorCheckpoints struct {
+	Version     string `json:"version"`
+	Checkpoints []struct {
+		Fingerprint struct {
+			DevInode []uint64 `json:"dev_inode"`
+		} `json:"fingerprint"`
+		Position int64 `json:"position"`
+	} `json:"checkpoints"`
+}
+
+// skippedFiles are the checkpoints files that had checkpoints without dev_inode fingerprint, logged once per file.
+var skippedFiles sync.Map
+
+func (r Vector) Read() ([]Position, error) { return readGlob(r.Glob, readVector) }
+
+func readVector(path string) ([]Position, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c vectorCheckpoints
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid vector checkpoints %v: %w", path, err)
+	}
+	if c.Version != "1" {
+		return nil, fmt.Errorf("unsupported vector checkpoints version %q: %v", c.Version, path)
+	}
+	positions := make([]Position, 0, len(c.Checkpoints))
+	skipped := 0
+	for _, cp := range c.Checkpoints {
+		if len(cp.Fingerprint.DevInode) != 2 {
+			skipped++
+			continue
+		}
+		positions = append(positions, Position{Dev: cp.Fingerprint.DevInode[0], Inode: cp.Fingerprint.DevInode[1], Offset: cp.Position})
+	}
+	if skipped > 0 {
+		if _, warned := skippedFiles.LoadOrStore(path, true); !warned {
+			log.Info("WARNING: skipping vector checkpoints without dev_inode fingerprint, the collector positions of their files are unknown;"+
+				" set fingerprint.strategy to device_and_inode in the vector source", "path", path, "skipped", skipped)
+		}
+		log.V(3).Info("skipped vector checkpoints without dev_inode fingerprint", "path", path, "skipped", skipped)
+	}
+	return positions, nil
+}
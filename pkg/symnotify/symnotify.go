@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	log "github.com/ViaQ/logerr/v2/log/static"
 	"github.com/fsnotify/fsnotify"
@@ -27,11 +28,39 @@ const (
 // Watcher is like fsnotify.Watcher but also notifies on changes to symlink targets
 type Watcher struct {
 	watcher *fsnotify.Watcher
+	mutex   sync.Mutex
+	watches map[string]bool // Watched paths.
 }
 
 func NewWatcher() (*Watcher, error) {
 	w, err := fsnotify.NewWatcher()
-	return &Watcher{watcher: w}, err
+	return &Watcher{watcher: w, watches: map[string]bool{}}, err
+}
+
+// Watches returns the number of inotify watches held by the watcher.
+func (w *Watcher) Watches() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.watches)
+}
+
+// add a watch for name, without scanning directories.
+func (w *Watcher) add(name string) error {
+	if err := w.watcher.Add(name); err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.watches[name] = true
+	return nil
+}
+
+// remove the watch for name.
+func (w *Watcher) remove(name string) error {
+	w.mutex.Lock()
+	delete(w.watches, name)
+	w.mutex.Unlock()
+	return w.watcher.Remove(name)
 }
 
 // Event returns the next event or an error.
@@ -57,14 +86,14 @@ func (w *Watcher) Event() (e Event, err error) {
 			}
 		}
 	case e.Op == Remove:
-		err = w.watcher.Remove(e.Name)
+		err = w.remove(e.Name)
 	case e.Op == Chmod || e.Op == Rename:
 		var info os.FileInfo
 		if info, err = os.Lstat(e.Name); err == nil {
 			if isSymlink(info) {
 				// Symlink target may have changed.
-				err = w.watcher.Remove(e.Name)
-				err = w.watcher.Add(e.Name)
+				err = w.remove(e.Name)
+				err = w.add(e.Name)
 			}
 		}
 	}
@@ -79,13 +108,13 @@ func (w *Watcher) Event() (e Event, err error) {
 // Remove name from watcher
 func (w *Watcher) Remove(name string) error {
 	log.V(3).Info("stop watching", "path", name)
-	return w.watcher.Remove(name)
+	return w.remove(name)
 }
 
 // Add a new directory, file or symlink to be watched.
 func (w *Watcher) Add(name string) (err error) {
 	log.V(3).Info("start watching", "path", name)
-	if err = w.watcher.Add(name); err != nil {
+	if err = w.add(name); err != nil {
 		log.Error(err, "error watching", "path", name)
 		return err
 	}
@@ -101,7 +130,7 @@ func (w *Watcher) Add(name string) (err error) {
 					log.Error(e, "Error path to watch", "path", newName)
 				}
 			case isSymlink(info):
-				if e := w.watcher.Add(newName); e != nil {
+				if e := w.add(newName); e != nil {
 					log.Error(e, "Error for symnotify#Add", "path", newName)
 				}
 			}
@@ -248,3 +248,16 @@ func TestWatchesSubdirectories(t *testing.T) {
 		assert.Equal(f.Event(), symnotify.Event{Name: log4, Op: symnotify.Write})
 	}
 }
+
+func TestWatches(t *testing.T) {
+	f := NewFixture(t)
+	sub := Join(f.Logs, "sub")
+	f.Mkdir(sub)
+	link, _ := f.Link("link")
+	require.NoError(t, f.Watcher.Add(f.Logs))
+	assert.Equal(t, 3, f.Watcher.Watches()) // logs, sub and link
+
+	require.NoError(t, os.Remove(link))
+	assert.Equal(t, symnotify.Event{Name: link, Op: symnotify.Remove}, f.Event())
+	assert.Equal(t, 2, f.Watcher.Watches())
+}